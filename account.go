@@ -0,0 +1,389 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// accountDeletionGrace is how long a deleted account can still be recovered
+// by logging in before it is purged for good.
+const accountDeletionGrace = 14 * 24 * time.Hour
+
+func (cfg *apiConfig) delete_account(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Password string `json:"password"`
+	}
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 401, "unknown user")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	_, err = cfg.Hasher.Verify(inc.Password, user.HashedPassword)
+	if err != nil {
+		respondWithError(writer, 401, "incorrect password")
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	err = queries.RequestAccountDeletion(request.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error deleting account")
+		return
+	}
+	err = queries.RevokeAllRefreshTokensForUser(request.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error deleting account")
+		return
+	}
+	err = queries.RevokeAllAPIKeysForUser(request.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error deleting account")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error committing account deletion")
+		return
+	}
+	type returnjason struct {
+		Purge_after time.Time `json:"purge_after"`
+	}
+	respondWithJSON(writer, 202, returnjason{Purge_after: time.Now().UTC().Add(accountDeletionGrace)})
+}
+
+// purgeDeletedAccounts removes accounts whose deletion grace period ran out.
+// Rows that reference the user go with it through ON DELETE CASCADE; stored
+// files have to be removed separately.
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context) error {
+	users, err := cfg.Queries.ListUsersDueForPurge(ctx, accountDeletionGrace.Seconds())
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		files, err := cfg.Queries.ListMediaKeysForUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		err = cfg.Queries.DeleteUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		keys := []string{}
+		for _, file := range files {
+			keys = append(keys, file.StorageKey, file.ThumbnailKey)
+		}
+		if user.AvatarKey.Valid {
+			keys = append(keys, user.AvatarKey.String)
+		}
+		cfg.deleteStoredMedia(ctx, keys)
+	}
+	if len(users) > 0 {
+		log.Printf("purged %d deleted accounts", len(users))
+	}
+	return nil
+}
+
+// export_account returns everything Chirpy stores about the caller as a ZIP
+// of JSON files.
+func (cfg *apiConfig) export_account(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	files, err := cfg.collectExport(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 500, "error collecting account data")
+		return
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range exportFiles {
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			respondWithError(writer, 500, "error encoding account data")
+			return
+		}
+		file, err := archive.Create(name)
+		if err == nil {
+			_, err = file.Write(data)
+		}
+		if err != nil {
+			respondWithError(writer, 500, "error writing export")
+			return
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		respondWithError(writer, 500, "error writing export")
+		return
+	}
+	filename := fmt.Sprintf("chirpy-export-%s.zip", time.Now().UTC().Format("2006-01-02"))
+	writer.Header().Set("Content-Type", "application/zip")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	writer.WriteHeader(200)
+	writer.Write(buf.Bytes())
+}
+
+// exportFiles lists the files of an account export in archive order.
+var exportFiles = []string{
+	"profile.json",
+	"chirps.json",
+	"sessions.json",
+	"api_keys.json",
+	"notifications.json",
+	"blocks.json",
+	"mutes.json",
+	"follows.json",
+	"reports.json",
+	"oauth_consents.json",
+	"handle_history.json",
+}
+
+func (cfg *apiConfig) collectExport(ctx context.Context, userID uuid.UUID) (map[string]interface{}, error) {
+	user, err := cfg.Queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	type profile struct {
+		profileJSON
+		Email             string     `json:"email"`
+		Updated_at        time.Time  `json:"updated_at"`
+		Email_verified_at *time.Time `json:"email_verified_at"`
+		Two_factor        bool       `json:"two_factor_enabled"`
+	}
+	exported := profile{
+		profileJSON: cfg.toProfileJSON(user),
+		Email:       user.Email,
+		Updated_at:  user.UpdatedAt,
+		Two_factor:  user.TotpEnabledAt.Valid,
+	}
+	if user.EmailVerifiedAt.Valid {
+		exported.Email_verified_at = &user.EmailVerifiedAt.Time
+	}
+
+	chirps, err := cfg.Queries.ListChirpsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := cfg.mediaForChirps(ctx, chirps)
+	if err != nil {
+		return nil, err
+	}
+	type chirp struct {
+		Id         uuid.UUID   `json:"id"`
+		Created_at time.Time   `json:"created_at"`
+		Updated_at time.Time   `json:"updated_at"`
+		Body       string      `json:"body"`
+		Publish_at time.Time   `json:"publish_at"`
+		Media      []mediaJSON `json:"media"`
+	}
+	exportedChirps := []chirp{}
+	for _, c := range chirps {
+		exportedChirps = append(exportedChirps, chirp{
+			Id:         c.ID,
+			Created_at: c.CreatedAt,
+			Updated_at: c.UpdatedAt,
+			Body:       c.Body,
+			Publish_at: c.PublishAt,
+			Media:      attachments[c.ID],
+		})
+	}
+
+	tokens, err := cfg.Queries.ListRefreshTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	type session struct {
+		Created_at time.Time  `json:"created_at"`
+		Expires_at time.Time  `json:"expires_at"`
+		Revoked_at *time.Time `json:"revoked_at"`
+		Client_id  *string    `json:"client_id"`
+	}
+	sessions := []session{}
+	for _, token := range tokens {
+		s := session{
+			Created_at: token.CreatedAt,
+			Expires_at: token.ExpiresAt,
+			Client_id:  nullableString(token.ClientID),
+		}
+		if token.RevokedAt.Valid {
+			s.Revoked_at = &token.RevokedAt.Time
+		}
+		sessions = append(sessions, s)
+	}
+
+	keys, err := cfg.Queries.ListAPIKeysForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	type apiKey struct {
+		Id           uuid.UUID  `json:"id"`
+		Created_at   time.Time  `json:"created_at"`
+		Name         string     `json:"name"`
+		Prefix       string     `json:"prefix"`
+		Scopes       string     `json:"scopes"`
+		Last_used_at *time.Time `json:"last_used_at"`
+	}
+	apiKeys := []apiKey{}
+	for _, key := range keys {
+		k := apiKey{
+			Id:         key.ID,
+			Created_at: key.CreatedAt,
+			Name:       key.Name,
+			Prefix:     key.Prefix,
+			Scopes:     key.Scopes,
+		}
+		if key.LastUsedAt.Valid {
+			k.Last_used_at = &key.LastUsedAt.Time
+		}
+		apiKeys = append(apiKeys, k)
+	}
+
+	notifications, err := cfg.Queries.ListNotificationsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	exportedNotifications := []notificationJSON{}
+	for _, notification := range notifications {
+		exportedNotifications = append(exportedNotifications, toNotificationJSON(notification))
+	}
+
+	// Blocks, mutes and follows are all exported as the other user and when
+	// the relationship started.
+	type relationship struct {
+		User_id    uuid.UUID `json:"user_id"`
+		Created_at time.Time `json:"created_at"`
+	}
+	blockRows, err := cfg.Queries.ListBlocksForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	blocks := []relationship{}
+	for _, block := range blockRows {
+		blocks = append(blocks, relationship{User_id: block.BlockedID, Created_at: block.CreatedAt})
+	}
+	muteRows, err := cfg.Queries.ListMutesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	mutes := []relationship{}
+	for _, mute := range muteRows {
+		mutes = append(mutes, relationship{User_id: mute.MutedID, Created_at: mute.CreatedAt})
+	}
+	followRows, err := cfg.Queries.ListFollowsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	follows := []relationship{}
+	for _, follow := range followRows {
+		follows = append(follows, relationship{User_id: follow.FollowedID, Created_at: follow.CreatedAt})
+	}
+
+	reportRows, err := cfg.Queries.ListReportsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	type report struct {
+		Id          uuid.UUID  `json:"id"`
+		Created_at  time.Time  `json:"created_at"`
+		Chirp_id    uuid.UUID  `json:"chirp_id"`
+		Reason      string     `json:"reason"`
+		Details     string     `json:"details"`
+		Status      string     `json:"status"`
+		Resolved_at *time.Time `json:"resolved_at"`
+	}
+	reports := []report{}
+	for _, row := range reportRows {
+		r := report{
+			Id:         row.ID,
+			Created_at: row.CreatedAt,
+			Chirp_id:   row.ChirpID,
+			Reason:     row.Reason,
+			Details:    row.Details,
+			Status:     row.Status,
+		}
+		if row.ResolvedAt.Valid {
+			r.Resolved_at = &row.ResolvedAt.Time
+		}
+		reports = append(reports, r)
+	}
+
+	consentRows, err := cfg.Queries.ListOAuthConsentsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	type consent struct {
+		Client_id   string    `json:"client_id"`
+		Client_name string    `json:"client_name"`
+		Scopes      string    `json:"scopes"`
+		Created_at  time.Time `json:"created_at"`
+	}
+	consents := []consent{}
+	for _, row := range consentRows {
+		consents = append(consents, consent{
+			Client_id:   row.ClientID,
+			Client_name: row.Name,
+			Scopes:      row.Scopes,
+			Created_at:  row.CreatedAt,
+		})
+	}
+
+	historyRows, err := cfg.Queries.ListHandleHistoryForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	type pastHandle struct {
+		Handle      string    `json:"handle"`
+		Released_at time.Time `json:"released_at"`
+		Expires_at  time.Time `json:"expires_at"`
+	}
+	handleHistory := []pastHandle{}
+	for _, row := range historyRows {
+		handleHistory = append(handleHistory, pastHandle{
+			Handle:      row.Handle,
+			Released_at: row.ReleasedAt,
+			Expires_at:  row.ExpiresAt,
+		})
+	}
+
+	return map[string]interface{}{
+		"profile.json":        exported,
+		"chirps.json":         exportedChirps,
+		"sessions.json":       sessions,
+		"api_keys.json":       apiKeys,
+		"notifications.json":  exportedNotifications,
+		"blocks.json":         blocks,
+		"mutes.json":          mutes,
+		"follows.json":        follows,
+		"reports.json":        reports,
+		"oauth_consents.json": consents,
+		"handle_history.json": handleHistory,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type deletedChirpJSON struct {
+	Id         uuid.UUID  `json:"id"`
+	Created_at time.Time  `json:"created_at"`
+	Body       string     `json:"body"`
+	User_id    uuid.UUID  `json:"user_id"`
+	Deleted_at *time.Time `json:"deleted_at"`
+	Deleted_by *uuid.UUID `json:"deleted_by"`
+}
+
+func toDeletedChirpJSON(chirp database.Chirp) deletedChirpJSON {
+	returning := deletedChirpJSON{
+		Id:         chirp.ID,
+		Created_at: chirp.CreatedAt,
+		Body:       chirp.Body,
+		User_id:    chirp.UserID,
+	}
+	if chirp.DeletedAt.Valid {
+		returning.Deleted_at = &chirp.DeletedAt.Time
+	}
+	if chirp.DeletedBy.Valid {
+		returning.Deleted_by = &chirp.DeletedBy.UUID
+	}
+	return returning
+}
+
+func (cfg *apiConfig) admin_list_deleted_chirps(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireRole(writer, request, roleModerator); !ok {
+		return
+	}
+	limit, offset := pagination(request)
+	chirps, err := cfg.Queries.ListDeletedChirps(request.Context(), database.ListDeletedChirpsParams{
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving deleted chirps")
+		return
+	}
+	returning := []deletedChirpJSON{}
+	for _, chirp := range chirps {
+		returning = append(returning, toDeletedChirpJSON(chirp))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) admin_restore_chirp(writer http.ResponseWriter, request *http.Request) {
+	actor, ok := cfg.requireRole(writer, request, roleModerator)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(request.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	chirp, err := queries.RestoreChirp(request.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "no deleted chirp with that ID")
+		return
+	}
+	err = audit(request.Context(), queries, actor, "chirp.restore", "chirp", chirp.ID, nil)
+	if err != nil {
+		respondWithError(writer, 500, "error writing audit log")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error committing restore")
+		return
+	}
+	respondWithJSON(writer, 200, toDeletedChirpJSON(chirp))
+}
+
+// purgeDeletedChirps removes chirps that have been soft deleted for longer
+// than the retention period, along with their stored media.
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) error {
+	files, err := cfg.Queries.PurgeDeletedChirps(ctx, cfg.DeletedChirpRetention.Seconds())
+	if err != nil {
+		return err
+	}
+	keys := []string{}
+	for _, file := range files {
+		keys = append(keys, file.StorageKey, file.ThumbnailKey)
+	}
+	cfg.deleteStoredMedia(ctx, keys)
+	if len(files) > 0 {
+		log.Printf("purged %d media files of deleted chirps", len(files))
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxSuspensionReasonLength = 500
+
+// adminUserJSON is the admin view of an account, including the private fields
+// profileJSON leaves out.
+type adminUserJSON struct {
+	Id                    uuid.UUID  `json:"id"`
+	Created_at            time.Time  `json:"created_at"`
+	Updated_at            time.Time  `json:"updated_at"`
+	Email                 string     `json:"email"`
+	Email_verified        bool       `json:"email_verified"`
+	Handle                *string    `json:"handle"`
+	Role                  string     `json:"role"`
+	Is_chirpy_red         bool       `json:"is_chirpy_red"`
+	Chirpy_red_granted    bool       `json:"chirpy_red_granted"`
+	Two_factor_enabled    bool       `json:"two_factor_enabled"`
+	Suspended_at          *time.Time `json:"suspended_at"`
+	Suspension_reason     *string    `json:"suspension_reason"`
+	Deletion_requested_at *time.Time `json:"deletion_requested_at"`
+}
+
+func toAdminUserJSON(user database.User) adminUserJSON {
+	returning := adminUserJSON{
+		Id:                 user.ID,
+		Created_at:         user.CreatedAt,
+		Updated_at:         user.UpdatedAt,
+		Email:              user.Email,
+		Email_verified:     user.EmailVerifiedAt.Valid,
+		Handle:             nullableString(user.Handle),
+		Role:               user.Role,
+		Is_chirpy_red:      user.IsChirpyRed,
+		Chirpy_red_granted: user.ChirpyRedGranted,
+		Two_factor_enabled: user.TotpEnabledAt.Valid,
+		Suspension_reason:  nullableString(user.SuspensionReason),
+	}
+	if user.SuspendedAt.Valid {
+		returning.Suspended_at = &user.SuspendedAt.Time
+	}
+	if user.DeletionRequestedAt.Valid {
+		returning.Deletion_requested_at = &user.DeletionRequestedAt.Time
+	}
+	return returning
+}
+
+// adminTarget loads the user named in the path.
+func (cfg *apiConfig) adminTarget(writer http.ResponseWriter, request *http.Request) (database.User, bool) {
+	id, err := uuid.Parse(request.PathValue("userID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return database.User{}, false
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "user not found")
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// runAdminAction applies change to target in a transaction together with its
+// audit log entry, then responds with the updated user.
+func (cfg *apiConfig) runAdminAction(writer http.ResponseWriter, request *http.Request, actor uuid.NullUUID, target database.User, action string, change func(ctx context.Context, queries *database.Queries) (interface{}, error)) {
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	details, err := change(request.Context(), queries)
+	if err != nil {
+		respondWithError(writer, 500, "error updating user")
+		return
+	}
+	err = audit(request.Context(), queries, actor, action, "user", target.ID, details)
+	if err != nil {
+		respondWithError(writer, 500, "error writing audit log")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error committing change")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), target.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving user")
+		return
+	}
+	respondWithJSON(writer, 200, toAdminUserJSON(user))
+}
+
+func (cfg *apiConfig) admin_search_users(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	limit, offset := pagination(request)
+	users, err := cfg.Queries.SearchUsersByEmail(request.Context(), database.SearchUsersByEmailParams{
+		Email:     request.URL.Query().Get("email"),
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error searching users")
+		return
+	}
+	returning := []adminUserJSON{}
+	for _, user := range users {
+		returning = append(returning, toAdminUserJSON(user))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) admin_get_user(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	user, ok := cfg.adminTarget(writer, request)
+	if !ok {
+		return
+	}
+	respondWithJSON(writer, 200, toAdminUserJSON(user))
+}
+
+func (cfg *apiConfig) admin_list_sessions(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	user, ok := cfg.adminTarget(writer, request)
+	if !ok {
+		return
+	}
+	tokens, err := cfg.Queries.ListRefreshTokensForUser(request.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving sessions")
+		return
+	}
+	type returnjason struct {
+		Created_at time.Time  `json:"created_at"`
+		Updated_at time.Time  `json:"updated_at"`
+		Expires_at time.Time  `json:"expires_at"`
+		Revoked_at *time.Time `json:"revoked_at"`
+		Client_id  *string    `json:"client_id"`
+	}
+	returning := []returnjason{}
+	for _, token := range tokens {
+		session := returnjason{
+			Created_at: token.CreatedAt,
+			Updated_at: token.UpdatedAt,
+			Expires_at: token.ExpiresAt,
+			Client_id:  nullableString(token.ClientID),
+		}
+		if token.RevokedAt.Valid {
+			session.Revoked_at = &token.RevokedAt.Time
+		}
+		returning = append(returning, session)
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+// admin_suspend_user suspends an account and ends all of its sessions.
+func (cfg *apiConfig) admin_suspend_user(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Reason string `json:"reason"`
+	}
+	actor, ok := cfg.requireAdmin(writer, request)
+	if !ok {
+		return
+	}
+	user, ok := cfg.adminTarget(writer, request)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	reason := strings.TrimSpace(inc.Reason)
+	if reason == "" || len(reason) > maxSuspensionReasonLength {
+		respondWithError(writer, 400, "a reason of at most 500 characters is required")
+		return
+	}
+	if actor.Valid && actor.UUID == user.ID {
+		respondWithError(writer, 400, "you cannot suspend yourself")
+		return
+	}
+	type details struct {
+		Reason string `json:"reason"`
+	}
+	cfg.runAdminAction(writer, request, actor, user, "user.suspend", func(ctx context.Context, queries *database.Queries) (interface{}, error) {
+		_, err := queries.SuspendUser(ctx, database.SuspendUserParams{
+			ID:               user.ID,
+			SuspensionReason: sql.NullString{String: reason, Valid: true},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return details{Reason: reason}, queries.RevokeAllRefreshTokensForUser(ctx, user.ID)
+	})
+}
+
+func (cfg *apiConfig) admin_unsuspend_user(writer http.ResponseWriter, request *http.Request) {
+	actor, ok := cfg.requireAdmin(writer, request)
+	if !ok {
+		return
+	}
+	user, ok := cfg.adminTarget(writer, request)
+	if !ok {
+		return
+	}
+	if !user.SuspendedAt.Valid {
+		respondWithError(writer, 409, "user is not suspended")
+		return
+	}
+	cfg.runAdminAction(writer, request, actor, user, "user.unsuspend", func(ctx context.Context, queries *database.Queries) (interface{}, error) {
+		_, err := queries.UnsuspendUser(ctx, user.ID)
+		return nil, err
+	})
+}
+
+// admin_logout_user revokes every refresh token of a user. Access tokens
+// already issued stay valid until they expire.
+func (cfg *apiConfig) admin_logout_user(writer http.ResponseWriter, request *http.Request) {
+	actor, ok := cfg.requireAdmin(writer, request)
+	if !ok {
+		return
+	}
+	user, ok := cfg.adminTarget(writer, request)
+	if !ok {
+		return
+	}
+	cfg.runAdminAction(writer, request, actor, user, "user.force_logout", func(ctx context.Context, queries *database.Queries) (interface{}, error) {
+		return nil, queries.RevokeAllRefreshTokensForUser(ctx, user.ID)
+	})
+}
+
+// admin_set_chirpy_red grants or revokes Chirpy Red by hand. Revoking only
+// removes the manual grant; a paid subscription keeps the plan active.
+func (cfg *apiConfig) admin_set_chirpy_red(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Granted *bool `json:"granted"`
+	}
+	actor, ok := cfg.requireAdmin(writer, request)
+	if !ok {
+		return
+	}
+	user, ok := cfg.adminTarget(writer, request)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil || inc.Granted == nil {
+		respondWithError(writer, 400, "granted is required")
+		return
+	}
+	action := "user.revoke_chirpy_red"
+	if *inc.Granted {
+		action = "user.grant_chirpy_red"
+	}
+	cfg.runAdminAction(writer, request, actor, user, action, func(ctx context.Context, queries *database.Queries) (interface{}, error) {
+		err := queries.SetChirpyRedGrant(ctx, database.SetChirpyRedGrantParams{
+			ID:               user.ID,
+			ChirpyRedGranted: *inc.Granted,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return nil, queries.SyncChirpyRed(ctx, user.ID)
+	})
+}
+
+func (cfg *apiConfig) admin_set_role(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Role string `json:"role"`
+	}
+	actor, ok := cfg.requireAdmin(writer, request)
+	if !ok {
+		return
+	}
+	user, ok := cfg.adminTarget(writer, request)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	if _, ok := roleRanks[inc.Role]; !ok {
+		respondWithError(writer, 400, "role must be user, moderator or admin")
+		return
+	}
+	if actor.Valid && actor.UUID == user.ID {
+		// Keeps the last admin from locking everyone out by accident.
+		respondWithError(writer, 400, "you cannot change your own role")
+		return
+	}
+	type details struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	cfg.runAdminAction(writer, request, actor, user, "user.set_role", func(ctx context.Context, queries *database.Queries) (interface{}, error) {
+		_, err := queries.SetUserRole(ctx, database.SetUserRoleParams{
+			ID:   user.ID,
+			Role: inc.Role,
+		})
+		return details{From: user.Role, To: inc.Role}, err
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type apiKeyJSON struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func toAPIKeyJSON(key database.ApiKey) apiKeyJSON {
+	returning := apiKeyJSON{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    strings.Fields(key.Scopes),
+		CreatedAt: key.CreatedAt,
+	}
+	if key.LastUsedAt.Valid {
+		returning.LastUsedAt = &key.LastUsedAt.Time
+	}
+	return returning
+}
+
+// authenticateAPIKey resolves an "Authorization: ApiKey ..." header to the
+// key's owner. Keys behave like OAuth tokens: they only reach endpoints that
+// accept one of their scopes.
+func (cfg *apiConfig) authenticateAPIKey(request *http.Request, scope string) (uuid.UUID, error) {
+	key, err := auth.GetAPIKey(request.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !auth.IsPersonalAPIKey(key) {
+		return uuid.Nil, errors.New("not a personal api key")
+	}
+	apiKey, err := cfg.Queries.GetAPIKeyByHash(request.Context(), auth.HashToken(key))
+	if err != nil {
+		return uuid.Nil, errors.New("unknown or revoked api key")
+	}
+	if scope == "" || !slices.Contains(strings.Fields(apiKey.Scopes), scope) {
+		return uuid.Nil, auth.ErrInsufficientScope
+	}
+	err = cfg.Queries.TouchAPIKey(request.Context(), apiKey.ID)
+	if err != nil {
+		log.Printf("error updating last use of api key %s: %s", apiKey.ID, err)
+	}
+	return apiKey.UserID, nil
+}
+
+func (cfg *apiConfig) create_api_key(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Name   string `json:"name"`
+		Scopes string `json:"scopes"`
+	}
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	if strings.TrimSpace(inc.Name) == "" {
+		respondWithError(writer, 400, "name is required")
+		return
+	}
+	scopes, err := auth.ParseScopes(inc.Scopes)
+	if err != nil {
+		respondWithError(writer, 400, err.Error())
+		return
+	}
+	key, prefix, err := auth.MakePersonalAPIKey()
+	if err != nil {
+		respondWithError(writer, 500, "error generating api key")
+		return
+	}
+	params := database.CreateAPIKeyParams{
+		UserID:  userID,
+		Name:    inc.Name,
+		Prefix:  prefix,
+		KeyHash: auth.HashToken(key),
+		Scopes:  strings.Join(scopes, " "),
+	}
+	apiKey, err := cfg.Queries.CreateAPIKey(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error storing api key")
+		return
+	}
+	returning := toAPIKeyJSON(apiKey)
+	// the key itself is only ever shown once
+	returning.Key = key
+	respondWithJSON(writer, 201, returning)
+}
+
+func (cfg *apiConfig) list_api_keys(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	keys, err := cfg.Queries.ListAPIKeysForUser(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving api keys")
+		return
+	}
+	returning := []apiKeyJSON{}
+	for _, key := range keys {
+		returning = append(returning, toAPIKeyJSON(key))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) revoke_api_key(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	keyID, err := uuid.Parse(request.PathValue("keyID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	revoked, err := cfg.Queries.RevokeAPIKey(request.Context(), database.RevokeAPIKeyParams{ID: keyID, UserID: userID})
+	if err != nil {
+		respondWithError(writer, 500, "error revoking api key")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(writer, 404, "api key not found")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// chirpFilter is the set of authors a viewer has muted or shares a block
+// with, in either direction. Every path that shows chirps to a user runs its
+// results through one.
+type chirpFilter map[uuid.UUID]bool
+
+func (cfg *apiConfig) chirpFilterFor(ctx context.Context, viewer uuid.UUID) (chirpFilter, error) {
+	filter := chirpFilter{}
+	if viewer == uuid.Nil {
+		return filter, nil
+	}
+	authors, err := cfg.Queries.ListFilteredAuthors(ctx, viewer)
+	if err != nil {
+		return nil, err
+	}
+	for _, author := range authors {
+		filter[author] = true
+	}
+	return filter, nil
+}
+
+// requestChirpFilter builds the filter for whoever made request. Chirp
+// listings are public, so anonymous callers simply get an empty filter.
+func (cfg *apiConfig) requestChirpFilter(request *http.Request) (chirpFilter, error) {
+	viewer, err := cfg.authenticate(request, auth.ScopeChirpsRead)
+	if err != nil {
+		viewer = uuid.Nil
+	}
+	return cfg.chirpFilterFor(request.Context(), viewer)
+}
+
+func (f chirpFilter) allows(author uuid.UUID) bool {
+	return !f[author]
+}
+
+func (f chirpFilter) apply(chirps []database.Chirp) []database.Chirp {
+	if len(f) == 0 {
+		return chirps
+	}
+	kept := []database.Chirp{}
+	for _, chirp := range chirps {
+		if f.allows(chirp.UserID) {
+			kept = append(kept, chirp)
+		}
+	}
+	return kept
+}
+
+// relationshipTarget authenticates the caller and resolves the user named in
+// the path for the block, mute and follow endpoints.
+func (cfg *apiConfig) relationshipTarget(writer http.ResponseWriter, request *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return uuid.Nil, uuid.Nil, false
+	}
+	targetID, err := uuid.Parse(request.PathValue("userID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if targetID == userID {
+		respondWithError(writer, 400, "you cannot block, mute or follow yourself")
+		return uuid.Nil, uuid.Nil, false
+	}
+	target, err := cfg.Queries.GetUserByID(request.Context(), targetID)
+	if err != nil || target.DeletionRequestedAt.Valid {
+		respondWithError(writer, 404, "user not found")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, target.ID, true
+}
+
+func (cfg *apiConfig) block_user(writer http.ResponseWriter, request *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(writer, request)
+	if !ok {
+		return
+	}
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error blocking user")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	err = queries.BlockUser(request.Context(), database.BlockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error blocking user")
+		return
+	}
+	// A block ends following in both directions.
+	err = queries.DeleteFollowsBetween(request.Context(), database.DeleteFollowsBetweenParams{
+		FollowerID: userID,
+		FollowedID: targetID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error blocking user")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error blocking user")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
+
+func (cfg *apiConfig) unblock_user(writer http.ResponseWriter, request *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(writer, request)
+	if !ok {
+		return
+	}
+	removed, err := cfg.Queries.UnblockUser(request.Context(), database.UnblockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error unblocking user")
+		return
+	}
+	if removed == 0 {
+		respondWithError(writer, 404, "user is not blocked")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
+
+func (cfg *apiConfig) mute_user(writer http.ResponseWriter, request *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(writer, request)
+	if !ok {
+		return
+	}
+	err := cfg.Queries.MuteUser(request.Context(), database.MuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error muting user")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
+
+func (cfg *apiConfig) unmute_user(writer http.ResponseWriter, request *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(writer, request)
+	if !ok {
+		return
+	}
+	removed, err := cfg.Queries.UnmuteUser(request.Context(), database.UnmuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error unmuting user")
+		return
+	}
+	if removed == 0 {
+		respondWithError(writer, 404, "user is not muted")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationExpiry = 48 * time.Hour
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeEmailVerificationToken(user.ID, user.Email, cfg.SecretToken, emailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy account",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email address by sending this token to POST /api/users/verify:\n\n%s\n\nThe token expires in %d hours.",
+			token, int(emailVerificationExpiry.Hours())),
+	}
+	return cfg.Mailer.Send(ctx, msg)
+}
+
+func (cfg *apiConfig) verify_email(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Token string `json:"token"`
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	userID, email, err := auth.ValidateEmailVerificationToken(inc.Token, cfg.SecretToken)
+	if err != nil {
+		respondWithError(writer, 400, "invalid or expired verification token")
+		return
+	}
+	params := database.VerifyUserEmailParams{
+		ID:    userID,
+		Email: email,
+	}
+	user, err := cfg.Queries.VerifyUserEmail(request.Context(), params)
+	if err != nil {
+		// the token was already used or the email changed since it was issued
+		respondWithError(writer, 400, "invalid or expired verification token")
+		return
+	}
+	type returnjason struct {
+		Id              uuid.UUID `json:"id"`
+		Email           string    `json:"email"`
+		EmailVerifiedAt time.Time `json:"email_verified_at"`
+	}
+	returning := returnjason{
+		Id:              user.ID,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt.Time,
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+// resend_verification_email mails a fresh verification token. Like the
+// password reset request it answers the same way whether or not the address
+// belongs to an unverified account, and mails off the request path.
+func (cfg *apiConfig) resend_verification_email(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	if wait, ok := cfg.VerifyIPLimiter.Allow(clientIP(request)); !ok {
+		respondTooManyRequests(writer, wait)
+		return
+	}
+	type returnjason struct {
+		Message string `json:"message"`
+	}
+	accepted := returnjason{
+		Message: "if the address belongs to an unverified account, a verification email has been sent",
+	}
+	if _, ok := cfg.VerifyAccountLimiter.Allow(strings.ToLower(inc.Email)); !ok {
+		respondWithJSON(writer, 202, accepted)
+		return
+	}
+	user, err := cfg.Queries.ReturnUserByEmail(request.Context(), inc.Email)
+	if err == nil && !user.EmailVerifiedAt.Valid {
+		go func() {
+			err := cfg.sendVerificationEmail(context.Background(), user)
+			if err != nil {
+				log.Printf("error sending verification email to %s: %s", user.Email, err)
+			}
+		}()
+	}
+	respondWithJSON(writer, 202, accepted)
+}
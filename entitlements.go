@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) planForUser(ctx context.Context, userID uuid.UUID) (entitlements.Plan, error) {
+	user, err := cfg.Queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return entitlements.Free, err
+	}
+	return entitlements.PlanFor(user.IsChirpyRed), nil
+}
+
+// respondWithUpgradeRequired answers 402 for features the caller's plan does
+// not include. 403 stays reserved for things no plan would allow.
+func respondWithUpgradeRequired(w http.ResponseWriter, feature entitlements.Feature) {
+	type returnjason struct {
+		Error        string `json:"error"`
+		Feature      string `json:"feature"`
+		RequiredPlan string `json:"required_plan"`
+	}
+	returning := returnjason{
+		Error:        "this feature requires Chirpy Red",
+		Feature:      string(feature),
+		RequiredPlan: string(entitlements.RequiredPlan(feature)),
+	}
+	respondWithJSON(w, 402, returning)
+}
+
+// checkChirpLength writes the error response for chirps that are too long
+// for plan and reports whether the chirp may be stored.
+func (cfg *apiConfig) checkChirpLength(writer http.ResponseWriter, plan entitlements.Plan, body string) bool {
+	if len(body) <= entitlements.Free.Limits().MaxChirpLength {
+		return true
+	}
+	if !plan.Allows(entitlements.LongChirps) {
+		respondWithUpgradeRequired(writer, entitlements.LongChirps)
+		return false
+	}
+	if len(body) > plan.Limits().MaxChirpLength {
+		respondWithError(writer, 400, "chirp to long")
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) edit_chirp(writer http.ResponseWriter, request *http.Request) {
+	type parameters struct {
+		Chirp string `json:"body"`
+	}
+	chirpID, err := uuid.Parse(request.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	userID, err := cfg.authenticate(request, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	chirp, err := cfg.Queries.GetChirpForAuthor(request.Context(), chirpID)
+	if err != nil {
+		respondWithError(writer, 404, "chirp not found")
+		return
+	}
+	if chirp.UserID != userID {
+		respondWithError(writer, 403, "edit not authorised")
+		return
+	}
+	plan, err := cfg.planForUser(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 401, "unknown user")
+		return
+	}
+	if !plan.Allows(entitlements.EditChirps) {
+		respondWithUpgradeRequired(writer, entitlements.EditChirps)
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	if !cfg.checkChirpLength(writer, plan, params.Chirp) {
+		return
+	}
+	validated, err := validate_chirp(params.Chirp, plan.Limits().MaxChirpLength)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	chirp, err = cfg.Queries.UpdateChirpBody(request.Context(), database.UpdateChirpBodyParams{Body: validated, ID: chirp.ID})
+	if err != nil {
+		respondWithError(writer, 500, "error updating chirp")
+		return
+	}
+	type returnjason struct {
+		Id         uuid.UUID   `json:"id"`
+		Created_at time.Time   `json:"created_at"`
+		Updated_at time.Time   `json:"updated_at"`
+		Body       string      `json:"body"`
+		User_id    uuid.UUID   `json:"user_id"`
+		Media      []mediaJSON `json:"media"`
+		Author     authorJSON  `json:"author"`
+	}
+	attachments, err := cfg.mediaForChirps(request.Context(), []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving media")
+		return
+	}
+	authors, err := cfg.authorsForChirps(request.Context(), []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving author")
+		return
+	}
+	returning := returnjason{
+		Id:         chirp.ID,
+		Created_at: chirp.CreatedAt,
+		Updated_at: chirp.UpdatedAt,
+		Body:       chirp.Body,
+		User_id:    chirp.UserID,
+		Media:      attachments[chirp.ID],
+		Author:     authors[chirp.UserID],
+	}
+	respondWithJSON(writer, 200, returning)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) follow_user(writer http.ResponseWriter, request *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(writer, request)
+	if !ok {
+		return
+	}
+	blocked, err := cfg.Queries.IsBlockedBetween(request.Context(), database.IsBlockedBetweenParams{
+		BlockerID: targetID,
+		BlockedID: userID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error following user")
+		return
+	}
+	if blocked {
+		respondWithError(writer, 403, "you cannot follow this user")
+		return
+	}
+	added, err := cfg.Queries.FollowUser(request.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FollowedID: targetID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error following user")
+		return
+	}
+	if added > 0 {
+		cfg.emit(request.Context(), busUserFollowed, interaction{Recipient: targetID, Actor: userID})
+	}
+	respondWithJSON(writer, 204, nil)
+}
+
+func (cfg *apiConfig) unfollow_user(writer http.ResponseWriter, request *http.Request) {
+	userID, targetID, ok := cfg.relationshipTarget(writer, request)
+	if !ok {
+		return
+	}
+	removed, err := cfg.Queries.UnfollowUser(request.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FollowedID: targetID,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error unfollowing user")
+		return
+	}
+	if removed == 0 {
+		respondWithError(writer, 404, "user is not followed")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
+
+// followedUsers returns the set of users viewer follows.
+func (cfg *apiConfig) followedUsers(request *http.Request, viewer uuid.UUID) (map[uuid.UUID]bool, error) {
+	followed, err := cfg.Queries.ListFollowedUsers(request.Context(), viewer)
+	if err != nil {
+		return nil, err
+	}
+	set := map[uuid.UUID]bool{}
+	for _, id := range followed {
+		set[id] = true
+	}
+	return set, nil
+}
@@ -10,4 +10,10 @@ require (
 
 require golang.org/x/crypto v0.40.0
 
-require github.com/golang-jwt/jwt/v5 v5.2.2 
+require (
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/image v0.25.0
+)
+
+require golang.org/x/sys v0.34.0 // indirect
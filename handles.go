@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/handles"
+	"github.com/lib/pq"
+)
+
+const (
+	// handleCooldown is how long a user has to wait between handle changes.
+	handleCooldown = 30 * 24 * time.Hour
+	// handleGracePeriod is how long an old handle keeps redirecting to its
+	// owner, and cannot be claimed by anyone else.
+	handleGracePeriod = 30 * 24 * time.Hour
+)
+
+func (cfg *apiConfig) rename_handle(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Handle string `json:"handle"`
+	}
+	userID, err := cfg.authenticate(request, auth.ScopeProfile)
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 401, "unknown user")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	err = handles.Validate(inc.Handle)
+	if err != nil {
+		respondWithError(writer, 400, err.Error())
+		return
+	}
+	if user.Handle.Valid && user.Handle.String == inc.Handle {
+		respondWithJSON(writer, 200, cfg.toProfileJSON(user))
+		return
+	}
+	// Changing only the capitalisation keeps the same handle, so it neither
+	// starts the cooldown check nor releases the old spelling.
+	caseOnly := user.Handle.Valid && handles.Normalize(user.Handle.String) == handles.Normalize(inc.Handle)
+	if user.Handle.Valid && !caseOnly && user.HandleChangedAt.Valid {
+		wait := time.Until(user.HandleChangedAt.Time.Add(handleCooldown))
+		if wait > 0 {
+			respondTooManyRequests(writer, wait)
+			return
+		}
+	}
+	released, err := cfg.Queries.GetHandleHistory(request.Context(), inc.Handle)
+	if err == nil && released.UserID != user.ID {
+		respondWithError(writer, 409, "handle already taken")
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	updated, err := queries.SetUserHandle(request.Context(), database.SetUserHandleParams{
+		Handle:        sql.NullString{String: inc.Handle, Valid: true},
+		StartCooldown: !caseOnly,
+		ID:            user.ID,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		respondWithError(writer, 409, "handle already taken")
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 500, "error changing handle")
+		return
+	}
+	err = queries.DeleteHandleHistory(request.Context(), inc.Handle)
+	if err != nil {
+		respondWithError(writer, 500, "error changing handle")
+		return
+	}
+	if user.Handle.Valid && !caseOnly {
+		err = queries.ReleaseHandle(request.Context(), database.ReleaseHandleParams{
+			Handle:       user.Handle.String,
+			UserID:       user.ID,
+			GraceSeconds: handleGracePeriod.Seconds(),
+		})
+		if err != nil {
+			respondWithError(writer, 500, "error changing handle")
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error committing handle change")
+		return
+	}
+	respondWithJSON(writer, 200, cfg.toProfileJSON(updated))
+}
+
+// redirectOldHandle points lookups of a recently released handle at the
+// profile of the user who gave it up.
+func (cfg *apiConfig) redirectOldHandle(writer http.ResponseWriter, request *http.Request, handle string) {
+	released, err := cfg.Queries.GetHandleHistory(request.Context(), handle)
+	if err != nil {
+		respondWithError(writer, 404, "user not found")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), released.UserID)
+	if err != nil || !user.Handle.Valid {
+		respondWithError(writer, 404, "user not found")
+		return
+	}
+	// Temporary: the old handle is only held for the grace period and may
+	// belong to someone else afterwards, so the redirect must not be cached.
+	http.Redirect(writer, request, "/api/users/by-handle/"+url.PathEscape(user.Handle.String), 302)
+}
@@ -0,0 +1,24 @@
+package auth
+
+import "strings"
+
+// personalAPIKeyPrefix makes personal keys recognisable in logs and secret
+// scanners.
+const personalAPIKeyPrefix = "chirpy_"
+
+// MakePersonalAPIKey returns a new key together with the short prefix shown
+// to the user to tell their keys apart. Only HashToken(key) should be stored.
+func MakePersonalAPIKey() (key, prefix string, err error) {
+	random, err := MakeRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = personalAPIKeyPrefix + random
+	return key, key[:len(personalAPIKeyPrefix)+6], nil
+}
+
+// IsPersonalAPIKey reports whether key looks like a key made by
+// MakePersonalAPIKey.
+func IsPersonalAPIKey(key string) bool {
+	return strings.HasPrefix(key, personalAPIKeyPrefix)
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -10,28 +11,19 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
+// DefaultPasswordHasher hashes new passwords with argon2id and still accepts
+// the bcrypt hashes created before it was introduced.
+var DefaultPasswordHasher = NewPasswordHasher(DefaultArgon2id, BcryptHasher{Cost: 10})
 
-	bitePassword := []byte(password)
-	hashedPassword, err := bcrypt.GenerateFromPassword(bitePassword, 10)
-	if err != nil {
-		return "", err
-	}
-	returnPassword := string(hashedPassword)
-	return returnPassword, nil
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher.Hash(password)
 }
 
 func CheckPasswordHash(password, hash string) error {
-	bytepassword := []byte(password)
-	byteHash := []byte(hash)
-	err := bcrypt.CompareHashAndPassword(byteHash, bytepassword)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := DefaultPasswordHasher.Verify(password, hash)
+	return err
 }
 
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
@@ -56,6 +48,9 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	if err != nil {
 		return uuid.Nil, err
 	}
+	if len(claims.Audience) > 0 {
+		return uuid.Nil, ErrWrongTokenPurpose
+	}
 	id, err := claims.GetSubject()
 	if err != nil {
 		return uuid.Nil, err
@@ -92,6 +87,13 @@ func MakeRefreshToken() (string, error) {
 	return hexstring, nil
 }
 
+// HashToken returns the hex encoded SHA-256 of a random token so it can be
+// stored and looked up without keeping the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authorisationHeader := headers.Get("Authorization")
 	if authorisationHeader == "" {
@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+var ErrPasswordMismatch = errors.New("password does not match hash")
+
+// Hasher is a single password hashing algorithm producing PHC style strings.
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) error
+	// Identifies reports whether hash was produced by this algorithm.
+	Identifies(hash string) bool
+	// NeedsRehash reports whether hash uses weaker parameters than the
+	// hasher is currently configured with.
+	NeedsRehash(hash string) bool
+}
+
+// PasswordHasher hashes new passwords with Preferred and verifies hashes
+// produced by any of the known algorithms. At most one hash per CPU is
+// computed at a time, since each argon2id run holds its full memory cost.
+type PasswordHasher struct {
+	Preferred Hasher
+	Known     []Hasher
+	slots     chan struct{}
+}
+
+func NewPasswordHasher(preferred Hasher, known ...Hasher) *PasswordHasher {
+	return &PasswordHasher{
+		Preferred: preferred,
+		Known:     append([]Hasher{preferred}, known...),
+		slots:     make(chan struct{}, runtime.NumCPU()),
+	}
+}
+
+// SetConcurrency changes how many hashes may be computed at once. Call it
+// before the hasher is in use.
+func (p *PasswordHasher) SetConcurrency(n int) {
+	if n > 0 {
+		p.slots = make(chan struct{}, n)
+	}
+}
+
+func (p *PasswordHasher) Hash(password string) (string, error) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+	return p.Preferred.Hash(password)
+}
+
+// Verify checks password against hash. When the password matches but the
+// hash was made with another algorithm or outdated parameters, rehash is true
+// and the caller should store a fresh hash.
+func (p *PasswordHasher) Verify(password, hash string) (rehash bool, err error) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+	for _, hasher := range p.Known {
+		if !hasher.Identifies(hash) {
+			continue
+		}
+		err = hasher.Verify(password, hash)
+		if err != nil {
+			return false, err
+		}
+		if hasher != p.Preferred {
+			return true, nil
+		}
+		return hasher.NeedsRehash(hash), nil
+	}
+	return false, ErrUnknownHashFormat
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (b BcryptHasher) Verify(password, hash string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (b BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost < b.Cost
+}
+
+// Argon2idHasher encodes hashes as
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<threads>$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory     uint32
+	Iterations uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2id is used unless ARGON2_MEMORY_KIB, ARGON2_ITERATIONS or
+// ARGON2_THREADS override it. It costs more than the OWASP minimum for
+// argon2id (19 MiB, 2 iterations, 1 thread).
+var DefaultArgon2id = Argon2idHasher{
+	Memory:     64 * 1024,
+	Iterations: 3,
+	Threads:    2,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+func (a Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Threads, a.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2idHasher) Verify(password, hash string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (a Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (a Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory < a.Memory ||
+		params.Iterations < a.Iterations ||
+		params.Threads < a.Threads ||
+		uint32(len(salt)) < a.SaltLength ||
+		uint32(len(key)) < a.KeyLength
+}
+
+func decodeArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	params := Argon2idHasher{}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Threads)
+	if err != nil {
+		return params, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	weakArgon := DefaultArgon2id
+	weakArgon.Iterations = 1
+	oldBcrypt := BcryptHasher{Cost: 4}
+	hasher := NewPasswordHasher(DefaultArgon2id, BcryptHasher{Cost: 10})
+
+	tests := []struct {
+		test           string
+		hasher         Hasher
+		password       string
+		expectedRehash bool
+		expectedErr    error
+	}{
+		{test: "current argon2id", hasher: DefaultArgon2id, password: "hunter2", expectedRehash: false},
+		{test: "outdated argon2id", hasher: weakArgon, password: "hunter2", expectedRehash: true},
+		{test: "legacy bcrypt", hasher: oldBcrypt, password: "hunter2", expectedRehash: true},
+	}
+	for _, test := range tests {
+		hash, err := test.hasher.Hash(test.password)
+		if err != nil {
+			t.Fatalf("test %q: error hashing: %v", test.test, err)
+		}
+		rehash, err := hasher.Verify(test.password, hash)
+		if err != nil {
+			t.Errorf("test %q: expected no error but recieved %v", test.test, err)
+		}
+		if rehash != test.expectedRehash {
+			t.Errorf("test %q: expected rehash %v but recieved %v", test.test, test.expectedRehash, rehash)
+		}
+		_, err = hasher.Verify("wrong", hash)
+		if !errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("test %q: expected %v but recieved %v", test.test, ErrPasswordMismatch, err)
+		}
+	}
+	_, err := hasher.Verify("hunter2", "plaintext")
+	if !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("expected %v but recieved %v", ErrUnknownHashFormat, err)
+	}
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Scopes third-party applications can request through OAuth.
+const (
+	ScopeProfile     = "profile"
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+)
+
+var KnownScopes = []string{ScopeProfile, ScopeChirpsRead, ScopeChirpsWrite}
+
+// PurposeOAuthAccess marks access tokens issued to third-party clients.
+const PurposeOAuthAccess = "chirpy-oauth"
+
+var ErrInsufficientScope = errors.New("token lacks the required scope")
+
+// ParseScopes splits a space separated scope string and rejects unknown
+// scopes. Duplicates are removed and the result is sorted.
+func ParseScopes(scope string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(KnownScopes, s) {
+			return nil, errors.New("unknown scope " + s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("no scope requested")
+	}
+	slices.Sort(scopes)
+	return scopes, nil
+}
+
+// VerifyPKCE checks a code verifier against the challenge sent to the
+// authorize endpoint. Only the S256 method is supported.
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if method != "S256" || len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// AccessToken describes an authenticated caller. First-party tokens made by
+// MakeJWT have an empty ClientID and carry every scope.
+type AccessToken struct {
+	UserID   uuid.UUID
+	ClientID string
+	Scopes   []string
+}
+
+func (a AccessToken) HasScope(scope string) bool {
+	if a.ClientID == "" {
+		return true
+	}
+	return slices.Contains(a.Scopes, scope)
+}
+
+type oauthClaims struct {
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id"`
+	jwt.RegisteredClaims
+}
+
+func MakeOAuthAccessToken(userID uuid.UUID, clientID string, scopes []string, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims := oauthClaims{
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{PurposeOAuthAccess},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+// ValidateAccessToken accepts both first-party tokens and OAuth access
+// tokens and reports who the caller is and what they may do.
+func ValidateAccessToken(tokenString, tokenSecret string) (AccessToken, error) {
+	userID, err := ValidateJWT(tokenString, tokenSecret)
+	if err == nil {
+		return AccessToken{UserID: userID}, nil
+	}
+	if !errors.Is(err, ErrWrongTokenPurpose) {
+		return AccessToken{}, err
+	}
+	claims := oauthClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(tokenSecret), nil
+	}, jwt.WithAudience(PurposeOAuthAccess), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return AccessToken{}, err
+	}
+	userID, err = uuid.Parse(claims.Subject)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	return AccessToken{
+		UserID:   userID,
+		ClientID: claims.ClientID,
+		Scopes:   strings.Fields(claims.Scope),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// challenge computed with: printf $verifier | openssl dgst -sha256 -binary | base64url
+	verifier := "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "ngF5GsXcbwljx6u133FFr3Xht9xooA_DuaX_3QwODtc"
+	if !VerifyPKCE(verifier, challenge, "S256") {
+		t.Errorf("expected verifier to match challenge")
+	}
+	if VerifyPKCE(verifier, challenge, "plain") {
+		t.Errorf("expected plain method to be rejected")
+	}
+	if VerifyPKCE(verifier+"x", challenge, "S256") {
+		t.Errorf("expected wrong verifier to be rejected")
+	}
+}
+
+func TestOAuthAccessToken(t *testing.T) {
+	secret := "oauth-secret"
+	id := uuid.New()
+	token, err := MakeOAuthAccessToken(id, "client", []string{ScopeChirpsWrite}, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	if _, err := ValidateJWT(token, secret); !errors.Is(err, ErrWrongTokenPurpose) {
+		t.Errorf("oauth token accepted as first-party token: %v", err)
+	}
+	access, err := ValidateAccessToken(token, secret)
+	if err != nil {
+		t.Fatalf("expected no error but recieved %v", err)
+	}
+	if access.UserID != id || !access.HasScope(ScopeChirpsWrite) || access.HasScope(ScopeProfile) {
+		t.Errorf("unexpected access token %+v", access)
+	}
+	firstParty, err := MakeJWT(id, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	access, err = ValidateAccessToken(firstParty, secret)
+	if err != nil || !access.HasScope(ScopeProfile) {
+		t.Errorf("first-party token should carry every scope: %+v, %v", access, err)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("chirps:write profile chirps:write")
+	if err != nil || len(scopes) != 2 || scopes[0] != ScopeChirpsWrite {
+		t.Errorf("unexpected scopes %v, %v", scopes, err)
+	}
+	if _, err := ParseScopes("admin"); err == nil {
+		t.Errorf("expected unknown scope to be rejected")
+	}
+}
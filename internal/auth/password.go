@@ -0,0 +1,110 @@
+package auth
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = loadCommonPasswords(commonPasswordList)
+
+// PasswordPolicy describes the rules a new password has to satisfy.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// RejectCommon rejects passwords found in the bundled list of common and
+	// breached passwords.
+	RejectCommon bool
+}
+
+// DefaultPasswordPolicy is used when no other policy has been configured.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:    8,
+	MaxLength:    72,
+	RequireUpper: true,
+	RequireLower: true,
+	RequireDigit: true,
+	RejectCommon: true,
+}
+
+// PasswordPolicyError lists every rule a password failed.
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet requirements: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks password against the policy and returns a
+// *PasswordPolicyError describing every violation, or nil.
+func (p PasswordPolicy) Validate(password string) error {
+	var problems []string
+	length := len([]rune(password))
+	if length < p.MinLength {
+		problems = append(problems, "must be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	// bcrypt silently ignores everything past 72 bytes
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		problems = append(problems, "must be at most "+strconv.Itoa(p.MaxLength)+" bytes long")
+	}
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		problems = append(problems, "must contain a symbol")
+	}
+	if p.RejectCommon && IsCommonPassword(password) {
+		problems = append(problems, "is too common or has appeared in a data breach")
+	}
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// IsCommonPassword reports whether password is in the bundled offline list
+// of common and breached passwords. The comparison ignores case.
+func IsCommonPassword(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
+
+func loadCommonPasswords(list string) map[string]struct{} {
+	passwords := map[string]struct{}{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
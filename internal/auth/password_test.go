@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		test     string
+		password string
+		problems int
+	}{
+		{test: "valid password", password: "Correct7Horse", problems: 0},
+		{test: "empty password", password: "", problems: 4},
+		{test: "too short", password: "Ab1", problems: 1},
+		{test: "missing classes", password: "alllowercase", problems: 2},
+		{test: "common password", password: "Password123", problems: 1},
+	}
+	for _, test := range tests {
+		err := DefaultPasswordPolicy.Validate(test.password)
+		if test.problems == 0 {
+			if err != nil {
+				t.Errorf("test %q: expected no error but recieved %v", test.test, err)
+			}
+			continue
+		}
+		var policyErr *PasswordPolicyError
+		if !errors.As(err, &policyErr) {
+			t.Errorf("test %q: expected a policy error but recieved %v", test.test, err)
+			continue
+		}
+		if len(policyErr.Problems) != test.problems {
+			t.Errorf("test %q: expected %d problems but recieved %v", test.test, test.problems, policyErr.Problems)
+		}
+	}
+}
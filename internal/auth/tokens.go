@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"net/mail"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Purpose tokens are signed JWTs restricted to a single use case through their
+// audience. ValidateJWT rejects them, so they can never be used as access tokens.
+const (
+	PurposeEmailVerification  = "chirpy-email-verification"
+	PurposeTwoFactorChallenge = "chirpy-2fa-challenge"
+)
+
+var ErrWrongTokenPurpose = errors.New("token was not issued for this purpose")
+
+type purposeClaims struct {
+	Email string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func makePurposeToken(purpose string, userID uuid.UUID, email, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims := purposeClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{purpose},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+func validatePurposeToken(purpose, tokenString, tokenSecret string) (purposeClaims, error) {
+	claims := purposeClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(tokenSecret), nil
+	}, jwt.WithAudience(purpose), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if errors.Is(err, jwt.ErrTokenInvalidAudience) {
+		return claims, ErrWrongTokenPurpose
+	}
+	return claims, err
+}
+
+// MakeEmailVerificationToken signs a token proving control over email. It is
+// bound to the address so changing the email invalidates older tokens.
+func MakeEmailVerificationToken(userID uuid.UUID, email, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makePurposeToken(PurposeEmailVerification, userID, email, tokenSecret, expiresIn)
+}
+
+func ValidateEmailVerificationToken(tokenString, tokenSecret string) (uuid.UUID, string, error) {
+	claims, err := validatePurposeToken(PurposeEmailVerification, tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	return userID, claims.Email, nil
+}
+
+// MakeTwoFactorChallenge signs the short-lived token handed out by login when
+// the password was correct but a second factor is still required.
+func MakeTwoFactorChallenge(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makePurposeToken(PurposeTwoFactorChallenge, userID, "", tokenSecret, expiresIn)
+}
+
+func ValidateTwoFactorChallenge(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := validatePurposeToken(PurposeTwoFactorChallenge, tokenString, tokenSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(claims.Subject)
+}
+
+// ValidateEmail accepts a bare address such as "user@example.com" and
+// rejects display names, missing domains and surrounding whitespace.
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return errors.New("invalid email address")
+	}
+	if address.Address != email || address.Name != "" {
+		return errors.New("invalid email address")
+	}
+	return nil
+}
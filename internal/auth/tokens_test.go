@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	secret := "verification-secret"
+	id := uuid.New()
+	token, err := MakeEmailVerificationToken(id, "user@example.com", secret, time.Minute)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	gotID, gotEmail, err := ValidateEmailVerificationToken(token, secret)
+	if err != nil || gotID != id || gotEmail != "user@example.com" {
+		t.Errorf("expected %v and user@example.com but recieved %v, %q, %v", id, gotID, gotEmail, err)
+	}
+	_, err = ValidateJWT(token, secret)
+	if !errors.Is(err, ErrWrongTokenPurpose) {
+		t.Errorf("verification token accepted as access token: %v", err)
+	}
+	access, err := MakeJWT(id, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	_, _, err = ValidateEmailVerificationToken(access, secret)
+	if err == nil {
+		t.Errorf("access token accepted as verification token")
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	valid := []string{"user@example.com", "first.last+tag@sub.example.org"}
+	invalid := []string{"", "user", "user@", " user@example.com", "Name <user@example.com>"}
+	for _, email := range valid {
+		if err := ValidateEmail(email); err != nil {
+			t.Errorf("expected %q to be valid but recieved %v", email, err)
+		}
+	}
+	for _, email := range invalid {
+		if err := ValidateEmail(email); err == nil {
+			t.Errorf("expected %q to be invalid", email)
+		}
+	}
+}
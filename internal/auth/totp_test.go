@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 appendix B test vector for SHA1, truncated to six digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	at := time.Unix(59, 0)
+
+	step, ok := ValidateTOTP(secret, "287082", at)
+	if !ok || step != 1 {
+		t.Errorf("expected code to be valid in step 1 but recieved %d, %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, "287082", at.Add(5*time.Minute)); ok {
+		t.Errorf("expected code to be expired")
+	}
+	if _, ok := ValidateTOTP(secret, "000000", at); ok {
+		t.Errorf("expected wrong code to be rejected")
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWebhookTimestamp = errors.New("webhook timestamp missing or outside the replay window")
+	ErrWebhookSignature = errors.New("webhook signature does not match")
+)
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a signature header of the form
+// "v1=<hex>[,v1=<hex>...]" against every active secret, so senders and
+// receivers can rotate secrets without downtime. The timestamp has to be
+// within tolerance of now to stop replays of old deliveries.
+func VerifyWebhookSignature(body []byte, timestamp, signatureHeader string, secrets []string, now time.Time, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookTimestamp
+	}
+	sent := time.Unix(seconds, 0)
+	if sent.Before(now.Add(-tolerance)) || sent.After(now.Add(tolerance)) {
+		return ErrWebhookTimestamp
+	}
+	for _, part := range strings.Split(signatureHeader, ",") {
+		signature, ok := strings.CutPrefix(strings.TrimSpace(part), "v1=")
+		if !ok {
+			continue
+		}
+		given, err := hex.DecodeString(signature)
+		if err != nil {
+			continue
+		}
+		for _, secret := range secrets {
+			expected, _ := hex.DecodeString(SignWebhook(secret, timestamp, body))
+			if hmac.Equal(given, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrWebhookSignature
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	oldTimestamp := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	secrets := []string{"new-secret", "old-secret"}
+
+	tests := []struct {
+		test        string
+		timestamp   string
+		signature   string
+		expectedErr error
+	}{
+		{test: "current secret", timestamp: timestamp, signature: "v1=" + SignWebhook("new-secret", timestamp, body)},
+		{test: "rotated out secret", timestamp: timestamp, signature: "v1=" + SignWebhook("old-secret", timestamp, body)},
+		{test: "several signatures", timestamp: timestamp, signature: "v1=abcd, v1=" + SignWebhook("new-secret", timestamp, body)},
+		{test: "unknown secret", timestamp: timestamp, signature: "v1=" + SignWebhook("other", timestamp, body), expectedErr: ErrWebhookSignature},
+		{test: "replayed delivery", timestamp: oldTimestamp, signature: "v1=" + SignWebhook("new-secret", oldTimestamp, body), expectedErr: ErrWebhookTimestamp},
+		{test: "missing timestamp", timestamp: "", signature: "v1=" + SignWebhook("new-secret", "", body), expectedErr: ErrWebhookTimestamp},
+	}
+	for _, test := range tests {
+		err := VerifyWebhookSignature(body, test.timestamp, test.signature, secrets, now, 5*time.Minute)
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("test %q: expected %v but recieved %v", test.test, test.expectedErr, err)
+		}
+	}
+}
@@ -7,29 +7,32 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at,updated_at,body,user_id)
+INSERT INTO chirps (id, created_at,updated_at,body,user_id,publish_at)
 VALUES(
     gen_random_UUID(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    GREATEST(NOW(), $3)
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	PublishAt time.Time
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.PublishAt)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,22 +40,19 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.HiddenAt,
+		&i.HideSource,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1
-`
-
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
-}
-
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source FROM chirps
+WHERE publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
 ORDER BY created_at ASC
 `
 
@@ -71,6 +71,11 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.HiddenAt,
+			&i.HideSource,
 		); err != nil {
 			return nil, err
 		}
@@ -85,9 +90,35 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
+const getChirpForAuthor = `-- name: GetChirpForAuthor :one
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+// Write paths check ownership themselves, and authors can still edit or
+// delete chirps that moderation has hidden.
+func (q *Queries) GetChirpForAuthor(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForAuthor, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.HiddenAt,
+		&i.HideSource,
+	)
+	return i, err
+}
+
 const getChirpFromID = `-- name: GetChirpFromID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source FROM chirps
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
 `
 
 func (q *Queries) GetChirpFromID(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -99,14 +130,43 @@ func (q *Queries) GetChirpFromID(ctx context.Context, id uuid.UUID) (Chirp, erro
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.HiddenAt,
+		&i.HideSource,
+	)
+	return i, err
+}
+
+const getChirpIncludingDeleted = `-- name: GetChirpIncludingDeleted :one
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source FROM chirps
+WHERE id = $1
+`
+
+func (q *Queries) GetChirpIncludingDeleted(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpIncludingDeleted, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.HiddenAt,
+		&i.HideSource,
 	)
 	return i, err
 }
 
 const getChirpsFromAuthor = `-- name: GetChirpsFromAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source
 FROM chirps
-where user_id = $1
+where user_id = $1 AND publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
 ORDER BY created_at ASC
 `
 
@@ -125,6 +185,146 @@ func (q *Queries) GetChirpsFromAuthor(ctx context.Context, userID uuid.UUID) ([]
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.HiddenAt,
+			&i.HideSource,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPublishedAfter = `-- name: GetChirpsPublishedAfter :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source FROM chirps
+WHERE (publish_at, id) > ($1::timestamp, $2::uuid) AND publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
+ORDER BY publish_at ASC, id ASC
+LIMIT $3
+`
+
+type GetChirpsPublishedAfterParams struct {
+	PublishAt time.Time
+	ID        uuid.UUID
+	RowLimit  int32
+}
+
+func (q *Queries) GetChirpsPublishedAfter(ctx context.Context, arg GetChirpsPublishedAfterParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPublishedAfter, arg.PublishAt, arg.ID, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.HiddenAt,
+			&i.HideSource,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScheduledChirpsDue = `-- name: GetScheduledChirpsDue :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source FROM chirps
+WHERE publish_at > created_at AND publish_at > $1 AND publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
+ORDER BY publish_at ASC, id ASC
+`
+
+func (q *Queries) GetScheduledChirpsDue(ctx context.Context, publishAt time.Time) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getScheduledChirpsDue, publishAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.HiddenAt,
+			&i.HideSource,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeletedChirps = `-- name: ListDeletedChirps :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source FROM chirps
+WHERE deleted_at IS NOT NULL
+ORDER BY deleted_at DESC
+LIMIT $1 OFFSET $2
+`
+
+type ListDeletedChirpsParams struct {
+	RowLimit  int32
+	RowOffset int32
+}
+
+func (q *Queries) ListDeletedChirps(ctx context.Context, arg ListDeletedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listDeletedChirps, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.HiddenAt,
+			&i.HideSource,
 		); err != nil {
 			return nil, err
 		}
@@ -139,6 +339,44 @@ func (q *Queries) GetChirpsFromAuthor(ctx context.Context, userID uuid.UUID) ([]
 	return items, nil
 }
 
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :many
+WITH purged AS (
+    DELETE FROM chirps
+    WHERE deleted_at <= NOW() - make_interval(secs => $1::float8)
+    RETURNING id
+)
+SELECT storage_key, thumbnail_key FROM media_attachments
+WHERE chirp_id IN (SELECT id FROM purged)
+`
+
+type PurgeDeletedChirpsRow struct {
+	StorageKey   string
+	ThumbnailKey string
+}
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, retentionSeconds float64) ([]PurgeDeletedChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeletedChirps, retentionSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PurgeDeletedChirpsRow
+	for rows.Next() {
+		var i PurgeDeletedChirpsRow
+		if err := rows.Scan(&i.StorageKey, &i.ThumbnailKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const resetChirpDatabase = `-- name: ResetChirpDatabase :exec
 DELETE FROM chirps *
 `
@@ -147,3 +385,77 @@ func (q *Queries) ResetChirpDatabase(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, resetChirpDatabase)
 	return err
 }
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, deleted_by = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source
+`
+
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.HiddenAt,
+		&i.HideSource,
+	)
+	return i, err
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW(), deleted_by = $2
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type SoftDeleteChirpParams struct {
+	ID        uuid.UUID
+	DeletedBy uuid.NullUUID
+}
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, arg SoftDeleteChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteChirp, arg.ID, arg.DeletedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, publish_at, deleted_at, deleted_by, hidden_at, hide_source
+`
+
+type UpdateChirpBodyParams struct {
+	Body string
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.PublishAt,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.HiddenAt,
+		&i.HideSource,
+	)
+	return i, err
+}
@@ -6,17 +6,140 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     string
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type AuditLog struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   uuid.UUID
+	Details    json.RawMessage
+}
+
 type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	PublishAt  time.Time
+	DeletedAt  sql.NullTime
+	DeletedBy  uuid.NullUUID
+	HiddenAt   sql.NullTime
+	HideSource sql.NullString
+}
+
+type HandleHistory struct {
+	Handle     string
+	UserID     uuid.UUID
+	ReleasedAt time.Time
+	ExpiresAt  time.Time
+}
+
+type JobCursor struct {
+	Name     string
+	Position time.Time
+}
+
+type MediaAttachment struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	ChirpID      uuid.UUID
+	Position     int32
+	ContentType  string
+	Width        int32
+	Height       int32
+	SizeBytes    int32
+	StorageKey   string
+	ThumbnailKey string
+}
+
+type Notification struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
+	UserID    uuid.UUID
+	ActorID   uuid.NullUUID
+	Type      string
+	ChirpID   uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string
+	CreatedAt           time.Time
+	ClientID            string
+	UserID              uuid.UUID
+	RedirectUri         string
+	Scopes              string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ExpiresAt           time.Time
+	UsedAt              sql.NullTime
+}
+
+type OauthClient struct {
+	ID           string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+}
+
+type OauthConsent struct {
+	UserID    uuid.UUID
+	ClientID  string
+	Scopes    string
+	CreatedAt time.Time
 	UpdatedAt time.Time
-	Body      string
+}
+
+type OutboundDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	SubscriptionID uuid.UUID
+	Event          string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastStatusCode sql.NullInt32
+	LastError      sql.NullString
+	DeliveredAt    sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
 	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
@@ -26,13 +149,100 @@ type RefreshToken struct {
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	ClientID  sql.NullString
+	Scopes    sql.NullString
+}
+
+type Report struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	ResolvedAt sql.NullTime
+}
+
+type Subscription struct {
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	UserID             uuid.UUID
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	CancelledAt        sql.NullTime
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	EmailVerifiedAt     sql.NullTime
+	TotpSecret          sql.NullString
+	TotpEnabledAt       sql.NullTime
+	TotpLastStep        int64
+	Handle              sql.NullString
+	DisplayName         string
+	Bio                 string
+	AvatarKey           sql.NullString
+	HandleChangedAt     sql.NullTime
+	DeletionRequestedAt sql.NullTime
+	Role                string
+	ChirpyRedGranted    bool
+	SuspendedAt         sql.NullTime
+	SuspensionReason    sql.NullString
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserFollow struct {
+	FollowerID uuid.UUID
+	FollowedID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID         uuid.UUID
+	ReceivedAt time.Time
+	Source     string
+	EventID    sql.NullString
+	Event      sql.NullString
+	Headers    json.RawMessage
+	Body       string
+	Outcome    string
+	StatusCode int32
+	Error      sql.NullString
+	ReplayOf   uuid.NullUUID
+}
+
+type WebhookEvent struct {
+	ID        string
+	CreatedAt time.Time
+	Source    string
+	Event     string
+}
+
+type WebhookSubscription struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Url       string
+	Secret    string
+	Events    []string
+	Active    bool
 }
@@ -7,8 +7,10 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -20,7 +22,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason
 `
 
 type CreateUserParams struct {
@@ -38,10 +40,179 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
 
+const enableTOTP = `-- name: EnableTOTP :exec
+UPDATE users
+SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) EnableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableTOTP, id)
+	return err
+}
+
+const getAccountStatus = `-- name: GetAccountStatus :one
+SELECT suspended_at, suspension_reason, deletion_requested_at FROM users
+WHERE id = $1
+`
+
+type GetAccountStatusRow struct {
+	SuspendedAt         sql.NullTime
+	SuspensionReason    sql.NullString
+	DeletionRequestedAt sql.NullTime
+}
+
+func (q *Queries) GetAccountStatus(ctx context.Context, id uuid.UUID) (GetAccountStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, getAccountStatus, id)
+	var i GetAccountStatusRow
+	err := row.Scan(&i.SuspendedAt, &i.SuspensionReason, &i.DeletionRequestedAt)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason FROM users
+WHERE LOWER(handle) = LOWER($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, lower string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, lower)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const getUsersByIDs = `-- name: GetUsersByIDs :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetUsersByIDs(ctx context.Context, dollar_1 []uuid.UUID) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByIDs, pq.Array(dollar_1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.EmailVerifiedAt,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.Handle,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarKey,
+			&i.HandleChangedAt,
+			&i.DeletionRequestedAt,
+			&i.Role,
+			&i.ChirpyRedGranted,
+			&i.SuspendedAt,
+			&i.SuspensionReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markEmailVerified, id)
+	return err
+}
+
 const resetUserDatabase = `-- name: ResetUserDatabase :exec
 DELETE FROM users *
 `
@@ -52,7 +223,7 @@ func (q *Queries) ResetUserDatabase(ctx context.Context) error {
 }
 
 const returnUserByEmail = `-- name: ReturnUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red from users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason from users
 WHERE email = $1
 `
 
@@ -66,6 +237,95 @@ func (q *Queries) ReturnUserByEmail(ctx context.Context, email string) (User, er
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const setTOTPSecret = `-- name: SetTOTPSecret :exec
+UPDATE users
+SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL
+`
+
+type SetTOTPSecretParams struct {
+	TotpSecret sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setTOTPSecret, arg.TotpSecret, arg.ID)
+	return err
+}
+
+const setUserAvatar = `-- name: SetUserAvatar :exec
+UPDATE users
+SET avatar_key = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type SetUserAvatarParams struct {
+	AvatarKey sql.NullString
+	ID        uuid.UUID
+}
+
+func (q *Queries) SetUserAvatar(ctx context.Context, arg SetUserAvatarParams) error {
+	_, err := q.db.ExecContext(ctx, setUserAvatar, arg.AvatarKey, arg.ID)
+	return err
+}
+
+const setUserHandle = `-- name: SetUserHandle :one
+UPDATE users
+SET handle = $1,
+    handle_changed_at = CASE WHEN $2::boolean THEN NOW() ELSE handle_changed_at END,
+    updated_at = NOW()
+WHERE id = $3
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason
+`
+
+type SetUserHandleParams struct {
+	Handle        sql.NullString
+	StartCooldown bool
+	ID            uuid.UUID
+}
+
+func (q *Queries) SetUserHandle(ctx context.Context, arg SetUserHandleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserHandle, arg.Handle, arg.StartCooldown, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
@@ -74,7 +334,7 @@ const updateUserData = `-- name: UpdateUserData :one
 UPDATE users
 SET email = $1, hashed_password = $2
 where id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason
 `
 
 type UpdateUserDataParams struct {
@@ -93,6 +353,77 @@ func (q *Queries) UpdateUserData(ctx context.Context, arg UpdateUserDataParams)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name = $1, bio = $2, updated_at = NOW()
+WHERE id = $3
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason
+`
+
+type UpdateUserProfileParams struct {
+	DisplayName string
+	Bio         string
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile, arg.DisplayName, arg.Bio, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
@@ -107,3 +438,62 @@ func (q *Queries) UpgrateToChirpyRed(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, upgrateToChirpyRed, id)
 	return err
 }
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND totp_last_step < $1
+`
+
+type UseTOTPStepParams struct {
+	TotpLastStep int64
+	ID           uuid.UUID
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.TotpLastStep, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, handle, display_name, bio, avatar_key, handle_changed_at, deletion_requested_at, role, chirpy_red_granted, suspended_at, suspension_reason
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarKey,
+		&i.HandleChangedAt,
+		&i.DeletionRequestedAt,
+		&i.Role,
+		&i.ChirpyRedGranted,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
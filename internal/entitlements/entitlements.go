@@ -0,0 +1,79 @@
+// Package entitlements is the single place that declares which features and
+// limits come with each plan.
+package entitlements
+
+import "time"
+
+type Plan string
+
+const (
+	Free      Plan = "free"
+	ChirpyRed Plan = "chirpy_red"
+)
+
+var Plans = []Plan{Free, ChirpyRed}
+
+type Feature string
+
+const (
+	LongChirps      Feature = "long_chirps"
+	EditChirps      Feature = "edit_chirps"
+	ScheduledChirps Feature = "scheduled_chirps"
+)
+
+// requiredPlan lists every gated feature. Features not listed are free.
+var requiredPlan = map[Feature]Plan{
+	LongChirps:      ChirpyRed,
+	EditChirps:      ChirpyRed,
+	ScheduledChirps: ChirpyRed,
+}
+
+// Limits are the quotas that differ between plans.
+type Limits struct {
+	MaxChirpLength int
+	ChirpsPerHour  int
+	// MaxScheduleAhead is how far in the future a chirp may be scheduled.
+	MaxScheduleAhead time.Duration
+}
+
+var limits = map[Plan]Limits{
+	Free: {
+		MaxChirpLength: 140,
+		ChirpsPerHour:  30,
+	},
+	ChirpyRed: {
+		MaxChirpLength:   1000,
+		ChirpsPerHour:    300,
+		MaxScheduleAhead: 30 * 24 * time.Hour,
+	},
+}
+
+func PlanFor(isChirpyRed bool) Plan {
+	if isChirpyRed {
+		return ChirpyRed
+	}
+	return Free
+}
+
+// Allows reports whether plan includes feature.
+func (p Plan) Allows(feature Feature) bool {
+	required, gated := requiredPlan[feature]
+	if !gated {
+		return true
+	}
+	// Chirpy Red is the top plan and includes every feature
+	return p == required || p == ChirpyRed
+}
+
+func (p Plan) Limits() Limits {
+	return limits[p]
+}
+
+// RequiredPlan returns the plan needed for feature.
+func RequiredPlan(feature Feature) Plan {
+	required, gated := requiredPlan[feature]
+	if !gated {
+		return Free
+	}
+	return required
+}
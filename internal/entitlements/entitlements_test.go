@@ -0,0 +1,21 @@
+package entitlements
+
+import "testing"
+
+func TestPlans(t *testing.T) {
+	if PlanFor(false).Allows(EditChirps) {
+		t.Errorf("free plan should not allow editing chirps")
+	}
+	if !PlanFor(true).Allows(EditChirps) {
+		t.Errorf("Chirpy Red should allow editing chirps")
+	}
+	if !PlanFor(false).Allows(Feature("ungated")) {
+		t.Errorf("features without a requirement should be free")
+	}
+	if PlanFor(false).Limits().MaxChirpLength != 140 {
+		t.Errorf("free chirps should stay at 140 characters")
+	}
+	if PlanFor(true).Limits().ChirpsPerHour <= PlanFor(false).Limits().ChirpsPerHour {
+		t.Errorf("Chirpy Red should have a higher rate limit")
+	}
+}
@@ -0,0 +1,73 @@
+// Package events is an in-process event bus. Handlers publish what happened
+// and return; subscribers such as notifications run on the bus's own
+// goroutine, off the request path.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+type Event struct {
+	Type    string
+	Payload interface{}
+}
+
+type Handler func(ctx context.Context, event Event) error
+
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	queue    chan Event
+}
+
+func NewBus(buffer int) *Bus {
+	return &Bus{
+		handlers: map[string][]Handler{},
+		queue:    make(chan Event, buffer),
+	}
+}
+
+// Subscribe registers handler for every event of the given type.
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Publish queues event for dispatch. It only blocks while the queue is full,
+// and gives up once ctx is done.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	select {
+	case b.queue <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run dispatches queued events until ctx is done. Handler errors are logged
+// and do not stop other handlers.
+func (b *Bus) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-b.queue:
+			b.dispatch(ctx, event)
+		}
+	}
+}
+
+func (b *Bus) dispatch(ctx context.Context, event Event) {
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		err := handler(ctx, event)
+		if err != nil {
+			log.Printf("error handling %s event: %s", event.Type, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus(4)
+	received := make(chan Event, 4)
+	bus.Subscribe("chirp.liked", func(ctx context.Context, event Event) error {
+		return errors.New("failing handler")
+	})
+	bus.Subscribe("chirp.liked", func(ctx context.Context, event Event) error {
+		received <- event
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bus.Run(ctx)
+
+	if err := bus.Publish(ctx, Event{Type: "user.followed"}); err != nil {
+		t.Fatalf("expected no error but recieved %v", err)
+	}
+	if err := bus.Publish(ctx, Event{Type: "chirp.liked", Payload: 1}); err != nil {
+		t.Fatalf("expected no error but recieved %v", err)
+	}
+	select {
+	case event := <-received:
+		if event.Payload != 1 {
+			t.Errorf("expected payload 1 but recieved %v", event.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("handler was not called after an earlier handler failed")
+	}
+	select {
+	case event := <-received:
+		t.Errorf("unexpected event %v", event)
+	default:
+	}
+}
+
+func TestBusPublishFull(t *testing.T) {
+	bus := NewBus(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	bus.Publish(ctx, Event{Type: "a"})
+	cancel()
+	if err := bus.Publish(ctx, Event{Type: "b"}); err == nil {
+		t.Errorf("expected an error publishing to a full bus after cancel")
+	}
+}
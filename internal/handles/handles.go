@@ -0,0 +1,103 @@
+// Package handles validates the public @handles users pick for themselves.
+package handles
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	MinLength = 3
+	MaxLength = 30
+	// MaxMentions caps how many users one chirp can notify.
+	MaxMentions = 10
+)
+
+var (
+	ErrInvalid  = errors.New("handles are 3 to 30 letters, digits or underscores and must contain a letter")
+	ErrReserved = errors.New("handle is reserved")
+)
+
+var pattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// mention matches an @handle that is not part of a longer word, so email
+// addresses are not picked up.
+var mention = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@])@([A-Za-z0-9_]+)`)
+
+// reserved holds names that would collide with routes or could be used to
+// impersonate the service. Compared case-insensitively.
+var reserved = map[string]bool{
+	"about":         true,
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"app":           true,
+	"assets":        true,
+	"auth":          true,
+	"chirpy":        true,
+	"help":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"media":         true,
+	"moderator":     true,
+	"null":          true,
+	"oauth":         true,
+	"polka":         true,
+	"root":          true,
+	"security":      true,
+	"settings":      true,
+	"signup":        true,
+	"staff":         true,
+	"status":        true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+	"www":           true,
+}
+
+// Normalize returns the form handles are compared in. The handle itself is
+// stored as the user typed it.
+func Normalize(handle string) string {
+	return strings.ToLower(handle)
+}
+
+func IsReserved(handle string) bool {
+	return reserved[Normalize(handle)]
+}
+
+// Validate checks the shape of handle and that it is not reserved. It does
+// not check whether someone else already has it.
+func Validate(handle string) error {
+	if !pattern.MatchString(handle) || !strings.ContainsFunc(handle, isLetter) {
+		return ErrInvalid
+	}
+	if IsReserved(handle) {
+		return ErrReserved
+	}
+	return nil
+}
+
+func isLetter(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
+
+// Mentions returns the distinct valid handles mentioned in body, in the order
+// they first appear and at most MaxMentions of them.
+func Mentions(body string) []string {
+	found := []string{}
+	seen := map[string]bool{}
+	for _, match := range mention.FindAllStringSubmatch(body, -1) {
+		handle := match[1]
+		if Validate(handle) != nil || seen[Normalize(handle)] {
+			continue
+		}
+		seen[Normalize(handle)] = true
+		found = append(found, handle)
+		if len(found) == MaxMentions {
+			break
+		}
+	}
+	return found
+}
@@ -0,0 +1,53 @@
+package handles
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		test        string
+		handle      string
+		expectedErr error
+	}{
+		{test: "simple", handle: "boots", expectedErr: nil},
+		{test: "digits and underscores", handle: "lane_99", expectedErr: nil},
+		{test: "too short", handle: "ab", expectedErr: ErrInvalid},
+		{test: "too long", handle: "abcdefghijklmnopqrstuvwxyz12345", expectedErr: ErrInvalid},
+		{test: "punctuation", handle: "boots.dev", expectedErr: ErrInvalid},
+		{test: "only digits", handle: "12345", expectedErr: ErrInvalid},
+		{test: "reserved", handle: "admin", expectedErr: ErrReserved},
+		{test: "reserved in another case", handle: "ApI", expectedErr: ErrReserved},
+	}
+	for _, test := range tests {
+		err := Validate(test.handle)
+		if err != test.expectedErr {
+			t.Errorf("test %q: expected %v but recieved %v", test.test, test.expectedErr, err)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		test     string
+		body     string
+		expected []string
+	}{
+		{test: "none", body: "hello world", expected: []string{}},
+		{test: "single", body: "hi @boots!", expected: []string{"boots"}},
+		{test: "start of body", body: "@lane_99 look", expected: []string{"lane_99"}},
+		{test: "duplicates in another case", body: "@boots and @Boots", expected: []string{"boots"}},
+		{test: "email address", body: "mail me at me@boots.dev", expected: []string{}},
+		{test: "double at", body: "@@boots", expected: []string{}},
+		{test: "invalid and reserved", body: "@ab @12345 @admin @wagslane", expected: []string{"wagslane"}},
+		{test: "too long", body: "@abcdefghijklmnopqrstuvwxyz12345", expected: []string{}},
+		{test: "capped", body: "@aaa @bbb @ccc @ddd @eee @fff @ggg @hhh @iii @jjj @kkk", expected: []string{"aaa", "bbb", "ccc", "ddd", "eee", "fff", "ggg", "hhh", "iii", "jjj"}},
+	}
+	for _, test := range tests {
+		mentions := Mentions(test.body)
+		if !slices.Equal(mentions, test.expected) {
+			t.Errorf("test %q: expected %v but recieved %v", test.test, test.expected, mentions)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers outgoing mail. Production deployments can plug in an SMTP
+// or API backed implementation; LogSender and FileSender are meant for local
+// development.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogSender writes every message to the standard logger.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender writes every message as a .eml file into Dir.
+type FileSender struct {
+	Dir string
+}
+
+func (f FileSender) Send(ctx context.Context, msg Message) error {
+	err := os.MkdirAll(f.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), recipient)
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+	return os.WriteFile(filepath.Join(f.Dir, name), []byte(content), 0o600)
+}
+
+// NewSender returns a FileSender when dir is set and a LogSender otherwise.
+func NewSender(dir string) Sender {
+	if dir != "" {
+		return FileSender{Dir: dir}
+	}
+	return LogSender{}
+}
@@ -0,0 +1,68 @@
+package media
+
+import "encoding/binary"
+
+// MaxFrames caps the frames of an animated GIF. gif.DecodeAll allocates a
+// buffer for every frame up front, so frames and their total pixels are
+// checked against the raw file before decoding.
+const MaxFrames = 300
+
+// checkGIFFrames walks the blocks of a GIF and rejects files with more than
+// MaxFrames frames or more than MaxPixels pixels across all frames.
+// Malformed files are left for the decoder to reject.
+func checkGIFFrames(data []byte) error {
+	if len(data) < 13 {
+		return ErrInvalidImage
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		// Global color table.
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+	frames, pixels := 0, 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21:
+			// Extension: introducer, label, then data sub-blocks.
+			pos = skipSubBlocks(data, pos+2)
+		case 0x2C:
+			if pos+10 > len(data) {
+				return ErrInvalidImage
+			}
+			width := int(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int(binary.LittleEndian.Uint16(data[pos+7:]))
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				// Local color table.
+				pos += 3 << (packed&0x07 + 1)
+			}
+			// Skip the LZW minimum code size, then the image data.
+			pos = skipSubBlocks(data, pos+1)
+			frames++
+			pixels += width * height
+			if frames > MaxFrames || pixels > MaxPixels {
+				return ErrTooLarge
+			}
+		case 0x3B:
+			return nil
+		default:
+			return ErrInvalidImage
+		}
+	}
+	return nil
+}
+
+// skipSubBlocks returns the position after the block terminator of the
+// sub-blocks starting at pos, or len(data) when they run off the end.
+func skipSubBlocks(data []byte, pos int) int {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos
+		}
+		pos += size
+	}
+	return len(data)
+}
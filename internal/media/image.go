@@ -0,0 +1,143 @@
+// Package media validates and stores images attached to chirps.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxImageBytes = 5 << 20
+	// MaxPixels guards against small files that decode to huge images. For
+	// animated GIFs it bounds the pixels of all frames together.
+	MaxPixels     = 40_000_000
+	ThumbnailSize = 320
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooLarge        = errors.New("image too large")
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+// Image is an upload after processing. Data is re-encoded from the decoded
+// pixels, which drops EXIF and any other metadata the original carried.
+type Image struct {
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+	Data        []byte
+	// Thumbnails are PNG for PNG uploads and JPEG for everything else.
+	Thumbnail     []byte
+	ThumbnailType string
+	ThumbnailExt  string
+}
+
+// Process sniffs the type of data rather than trusting the client, then
+// re-encodes it and renders a thumbnail no larger than ThumbnailSize on
+// either side. WebP uploads are stored as PNG.
+func Process(data []byte) (Image, error) {
+	if len(data) > MaxImageBytes {
+		return Image{}, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return Image{}, ErrUnsupportedType
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return Image{}, ErrTooLarge
+	}
+
+	var out bytes.Buffer
+	var img image.Image
+	result := Image{}
+	switch contentType {
+	case "image/gif":
+		// Keep every frame so animations survive re-encoding.
+		if err := checkGIFFrames(data); err != nil {
+			return Image{}, err
+		}
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return Image{}, ErrInvalidImage
+		}
+		err = gif.EncodeAll(&out, anim)
+		if err != nil {
+			return Image{}, err
+		}
+		img = anim.Image[0]
+		result.ContentType, result.Ext = "image/gif", "gif"
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Image{}, ErrInvalidImage
+		}
+		img = orient(img, jpegOrientation(data))
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 85})
+		if err != nil {
+			return Image{}, err
+		}
+		result.ContentType, result.Ext = "image/jpeg", "jpg"
+	default:
+		img, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Image{}, ErrInvalidImage
+		}
+		err = png.Encode(&out, img)
+		if err != nil {
+			return Image{}, err
+		}
+		result.ContentType, result.Ext = "image/png", "png"
+	}
+	result.Data = out.Bytes()
+	result.Width = img.Bounds().Dx()
+	result.Height = img.Bounds().Dy()
+	result.Thumbnail, err = thumbnail(img, result.ContentType)
+	if err != nil {
+		return Image{}, err
+	}
+	result.ThumbnailType, result.ThumbnailExt = "image/jpeg", "jpg"
+	if result.ContentType == "image/png" {
+		result.ThumbnailType, result.ThumbnailExt = "image/png", "png"
+	}
+	return result, nil
+}
+
+// thumbnail scales img to fit ThumbnailSize. PNG keeps its transparency.
+func thumbnail(img image.Image, contentType string) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			width, height = ThumbnailSize, max(1, height*ThumbnailSize/bounds.Dx())
+		} else {
+			width, height = max(1, width*ThumbnailSize/bounds.Dy()), ThumbnailSize
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	var out bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&out, dst)
+	} else {
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 80})
+	}
+	return out.Bytes(), err
+}
@@ -0,0 +1,114 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF segment with the given orientation right
+// after the SOI marker of a JPEG.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+	return append(append([]byte{0xFF, 0xD8}, segment...), jpg[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	img, err := Process(encodePNG(t, 800, 400))
+	if err != nil {
+		t.Fatalf("expected no error but recieved %v", err)
+	}
+	if img.ContentType != "image/png" || img.Width != 800 || img.Height != 400 {
+		t.Errorf("expected 800x400 image/png but recieved %dx%d %s", img.Width, img.Height, img.ContentType)
+	}
+	thumb, err := png.DecodeConfig(bytes.NewReader(img.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail: %v", err)
+	}
+	if thumb.Width != ThumbnailSize || thumb.Height != ThumbnailSize/2 {
+		t.Errorf("expected a %dx%d thumbnail but recieved %dx%d", ThumbnailSize, ThumbnailSize/2, thumb.Width, thumb.Height)
+	}
+
+	if _, err := Process([]byte("definitely not an image")); err != ErrUnsupportedType {
+		t.Errorf("expected %v but recieved %v", ErrUnsupportedType, err)
+	}
+}
+
+func TestProcessStripsEXIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatal(err)
+	}
+	upload := withOrientation(buf.Bytes(), 6)
+	if orientation := jpegOrientation(upload); orientation != 6 {
+		t.Fatalf("expected orientation 6 but recieved %d", orientation)
+	}
+	img, err := Process(upload)
+	if err != nil {
+		t.Fatalf("expected no error but recieved %v", err)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) {
+		t.Errorf("processed image still contains EXIF data")
+	}
+	if img.Width != 20 || img.Height != 40 {
+		t.Errorf("expected the rotation to be applied but recieved %dx%d", img.Width, img.Height)
+	}
+}
+
+func encodeGIF(t *testing.T, frames, w, h int) []byte {
+	anim := &gif.GIF{}
+	palette := color.Palette{color.Black, color.White}
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, w, h), palette))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessGIFFrameLimits(t *testing.T) {
+	type testCase struct {
+		test     string
+		upload   []byte
+		expected error
+	}
+	tests := []testCase{
+		{test: "small animation", upload: encodeGIF(t, 3, 20, 10), expected: nil},
+		{test: "too many frames", upload: encodeGIF(t, MaxFrames+1, 1, 1), expected: ErrTooLarge},
+		{test: "too many pixels", upload: encodeGIF(t, 3, 4000, 4000), expected: ErrTooLarge},
+	}
+	for _, c := range tests {
+		_, err := Process(c.upload)
+		if err != c.expected {
+			t.Errorf("test %q: expected %v but recieved %v", c.test, c.expected, err)
+		}
+	}
+}
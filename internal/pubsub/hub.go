@@ -0,0 +1,84 @@
+// Package pubsub fans messages out to in-process subscribers. Broker is the
+// seam for swapping the in-memory Hub for one backed by Postgres
+// LISTEN/NOTIFY when Chirpy runs on more than one instance.
+package pubsub
+
+import "sync"
+
+type Message struct {
+	ID    string
+	Event string
+	Data  []byte
+}
+
+type Broker interface {
+	Publish(topic string, msg Message)
+	Subscribe(topic string, buffer int) *Subscription
+	Unsubscribe(sub *Subscription)
+}
+
+// Subscription receives the messages published to its topic on C. A
+// subscriber that falls more than its buffer behind is dropped and C is
+// closed, so it should reconnect and resume from the last ID it saw.
+type Subscription struct {
+	C     <-chan Message
+	ch    chan Message
+	topic string
+}
+
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: map[string]map[*Subscription]struct{}{}}
+}
+
+func (h *Hub) Subscribe(topic string, buffer int) *Subscription {
+	ch := make(chan Message, buffer)
+	sub := &Subscription{C: ch, ch: ch, topic: topic}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[*Subscription]struct{}{}
+	}
+	h.topics[topic][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes sub and closes its channel. It is safe to call more
+// than once and after the hub dropped the subscriber.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Publish never blocks: subscribers with a full buffer are dropped.
+func (h *Hub) Publish(topic string, msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.topics[topic] {
+		select {
+		case sub.ch <- msg:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	subs, ok := h.topics[sub.topic]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.ch)
+	if len(subs) == 0 {
+		delete(h.topics, sub.topic)
+	}
+}
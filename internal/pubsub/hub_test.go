@@ -0,0 +1,34 @@
+package pubsub
+
+import "testing"
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	chirps := h.Subscribe("chirps", 1)
+	other := h.Subscribe("other", 1)
+
+	h.Publish("chirps", Message{ID: "1"})
+	msg, ok := <-chirps.C
+	if !ok || msg.ID != "1" {
+		t.Errorf("expected message 1 but recieved %v", msg)
+	}
+	select {
+	case msg := <-other.C:
+		t.Errorf("subscriber of another topic recieved %v", msg)
+	default:
+	}
+
+	h.Publish("chirps", Message{ID: "2"})
+	h.Publish("chirps", Message{ID: "3"})
+	if msg := <-chirps.C; msg.ID != "2" {
+		t.Errorf("expected message 2 but recieved %v", msg)
+	}
+	if _, ok := <-chirps.C; ok {
+		t.Errorf("slow subscriber should have been dropped")
+	}
+	h.Unsubscribe(chirps)
+	h.Unsubscribe(other)
+	if _, ok := <-other.C; ok {
+		t.Errorf("channel should be closed after unsubscribing")
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff counts failed attempts per key and blocks further attempts with an
+// exponentially growing delay. After MaxFailures the key is locked out for
+// the full Lockout duration. Attempts still in flight count against
+// MaxFailures, so a burst of parallel attempts cannot all get in before the
+// first failure is recorded.
+type Backoff struct {
+	mu          sync.Mutex
+	entries     map[string]*backoffEntry
+	MaxFailures int
+	BaseDelay   time.Duration
+	Lockout     time.Duration
+}
+
+type backoffEntry struct {
+	failures     int
+	inFlight     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+func NewBackoff(maxFailures int, baseDelay, lockout time.Duration) *Backoff {
+	return &Backoff{
+		entries:     map[string]*backoffEntry{},
+		MaxFailures: maxFailures,
+		BaseDelay:   baseDelay,
+		Lockout:     lockout,
+	}
+}
+
+// Allow reports whether an attempt for key may proceed right now and, if so,
+// reserves it until Done is called. When it may not, the returned duration
+// is how long the caller has to wait.
+func (b *Backoff) Allow(key string) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.prune(now)
+	entry, ok := b.entries[key]
+	if !ok {
+		entry = &backoffEntry{}
+		b.entries[key] = entry
+	}
+	wait := entry.blockedUntil.Sub(now)
+	if wait > 0 {
+		return wait, false
+	}
+	if entry.failures+entry.inFlight >= b.MaxFailures {
+		return b.BaseDelay, false
+	}
+	entry.inFlight++
+	return 0, true
+}
+
+// Done releases the attempt Allow reserved for key. Call it once the
+// outcome has been recorded with Fail or Reset, or the attempt succeeded.
+func (b *Backoff) Done(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if entry, ok := b.entries[key]; ok && entry.inFlight > 0 {
+		entry.inFlight--
+	}
+}
+
+// Fail records a failed attempt for key and returns the delay before the
+// next attempt is allowed.
+func (b *Backoff) Fail(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.prune(now)
+	entry, ok := b.entries[key]
+	if !ok {
+		entry = &backoffEntry{}
+		b.entries[key] = entry
+	} else if now.Sub(entry.lastFailure) > b.Lockout {
+		entry.failures = 0
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures >= b.MaxFailures {
+		entry.failures = 0
+		entry.blockedUntil = now.Add(b.Lockout)
+		return b.Lockout
+	}
+	delay := b.BaseDelay << (entry.failures - 1)
+	if delay > b.Lockout {
+		delay = b.Lockout
+	}
+	entry.blockedUntil = now.Add(delay)
+	return delay
+}
+
+// Reset forgets all failures recorded for key.
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
+
+func (b *Backoff) prune(now time.Time) {
+	for key, entry := range b.entries {
+		if entry.inFlight == 0 && now.After(entry.blockedUntil) && now.Sub(entry.lastFailure) > b.Lockout {
+			delete(b.entries, key)
+		}
+	}
+}
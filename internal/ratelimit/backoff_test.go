@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(3, 10*time.Millisecond, time.Hour)
+
+	if _, ok := b.Allow("user"); !ok {
+		t.Fatalf("fresh key should be allowed")
+	}
+	if delay := b.Fail("user"); delay != 10*time.Millisecond {
+		t.Errorf("first failure: expected 10ms delay but recieved %v", delay)
+	}
+	if _, ok := b.Allow("user"); ok {
+		t.Errorf("key should be blocked during backoff")
+	}
+	if _, ok := b.Allow("other"); !ok {
+		t.Errorf("unrelated key should not be blocked")
+	}
+	if delay := b.Fail("user"); delay != 20*time.Millisecond {
+		t.Errorf("second failure: expected 20ms delay but recieved %v", delay)
+	}
+	if delay := b.Fail("user"); delay != time.Hour {
+		t.Errorf("third failure: expected lockout but recieved %v", delay)
+	}
+	b.Reset("user")
+	if _, ok := b.Allow("user"); !ok {
+		t.Errorf("key should be allowed after reset")
+	}
+}
+
+func TestBackoffInFlight(t *testing.T) {
+	b := NewBackoff(2, 10*time.Millisecond, time.Hour)
+
+	if _, ok := b.Allow("user"); !ok {
+		t.Fatalf("first attempt should be allowed")
+	}
+	if _, ok := b.Allow("user"); !ok {
+		t.Fatalf("second attempt should be allowed")
+	}
+	if _, ok := b.Allow("user"); ok {
+		t.Errorf("third parallel attempt should wait for the first two")
+	}
+	b.Done("user")
+	if _, ok := b.Allow("user"); !ok {
+		t.Errorf("attempt should be allowed once one finished")
+	}
+	b.Fail("user")
+	b.Done("user")
+	b.Done("user")
+	if _, ok := b.Allow("user"); ok {
+		t.Errorf("key should be blocked after a failure")
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Window allows at most Limit attempts per key within each Period.
+type Window struct {
+	mu      sync.Mutex
+	entries map[string]*windowEntry
+	Limit   int
+	Period  time.Duration
+}
+
+type windowEntry struct {
+	count int
+	start time.Time
+}
+
+func NewWindow(limit int, period time.Duration) *Window {
+	return &Window{
+		entries: map[string]*windowEntry{},
+		Limit:   limit,
+		Period:  period,
+	}
+}
+
+// Allow records an attempt for key and reports whether it is within the
+// limit. When it is not, the returned duration is the time until the window
+// resets.
+func (w *Window) Allow(key string) (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	w.prune(now)
+	entry, ok := w.entries[key]
+	if !ok {
+		entry = &windowEntry{start: now}
+		w.entries[key] = entry
+	}
+	if entry.count >= w.Limit {
+		return entry.start.Add(w.Period).Sub(now), false
+	}
+	entry.count++
+	return 0, true
+}
+
+func (w *Window) prune(now time.Time) {
+	for key, entry := range w.entries {
+		if now.Sub(entry.start) >= w.Period {
+			delete(w.entries, key)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	w := NewWindow(2, 20*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, ok := w.Allow("ip"); !ok {
+			t.Fatalf("attempt %d should be allowed", i+1)
+		}
+	}
+	if _, ok := w.Allow("ip"); ok {
+		t.Errorf("third attempt should be limited")
+	}
+	time.Sleep(25 * time.Millisecond)
+	if _, ok := w.Allow("ip"); !ok {
+		t.Errorf("attempt after the window should be allowed")
+	}
+}
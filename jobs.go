@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// startBackgroundJobs runs periodic maintenance for as long as ctx lives.
+func (cfg *apiConfig) startBackgroundJobs(ctx context.Context) {
+	go cfg.Bus.Run(ctx)
+	go runEvery(ctx, time.Minute, "expire subscriptions", cfg.expireSubscriptions)
+	go runEvery(ctx, outboundPollInterval, "deliver webhooks", cfg.deliverWebhooks)
+	go runEvery(ctx, time.Hour, "purge deleted accounts", cfg.purgeDeletedAccounts)
+	go runEvery(ctx, time.Hour, "purge deleted chirps", cfg.purgeDeletedChirps)
+	go runEvery(ctx, scheduledInterval, "publish scheduled chirps", cfg.publishScheduledChirps())
+}
+
+func runEvery(ctx context.Context, interval time.Duration, name string, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := job(ctx)
+		if err != nil {
+			log.Printf("error running job %q: %s", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireSubscriptions ends subscriptions whose paid period lapsed and takes
+// Chirpy Red away from users without an active subscription.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) error {
+	expired, err := cfg.Queries.ExpireLapsedSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	downgraded, err := cfg.Queries.SyncAllChirpyRed(ctx)
+	if err != nil {
+		return err
+	}
+	if expired > 0 || downgraded > 0 {
+		log.Printf("expired %d subscriptions, removed Chirpy Red from %d users", expired, downgraded)
+	}
+	return nil
+}
@@ -7,101 +7,233 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/Dirza1/Chirpy/internal/auth"
 	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/entitlements"
+	"github.com/Dirza1/Chirpy/internal/events"
+	"github.com/Dirza1/Chirpy/internal/mailer"
+	"github.com/Dirza1/Chirpy/internal/media"
+	"github.com/Dirza1/Chirpy/internal/pubsub"
+	"github.com/Dirza1/Chirpy/internal/ratelimit"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
+// utcSession pins the connection's time zone to UTC. Timestamps are stored
+// without a zone, so values written from Go in UTC only line up with NOW()
+// when the session runs in UTC as well.
+func utcSession(dbURL string) string {
+	if strings.Contains(dbURL, "://") {
+		if strings.Contains(dbURL, "?") {
+			return dbURL + "&timezone=UTC"
+		}
+		return dbURL + "?timezone=UTC"
+	}
+	return dbURL + " timezone=UTC"
+}
+
 func main() {
 	godotenv.Load(".env")
 	dbURL := os.Getenv("DB_URL")
 	platform := os.Getenv("PLATFORM")
 	secretToken := os.Getenv("TOKEN")
 	pokaKey := os.Getenv("POLKA_KEY")
-	db, err := sql.Open("postgres", dbURL)
+	polkaSecrets := os.Getenv("POLKA_WEBHOOK_SECRETS")
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	db, err := sql.Open("postgres", utcSession(dbURL))
 	if err != nil {
 		log.Println("error opening database")
 		os.Exit(1)
 	}
 
 	apiCfg := apiConfig{}
+	apiCfg.DB = db
 	apiCfg.Queries = database.New(db)
 	apiCfg.PLATFORM = platform
 	apiCfg.SecretToken = secretToken
 	apiCfg.PolkaKKey = pokaKey
+	apiCfg.AdminKey = adminKey
+	for _, secret := range strings.Split(polkaSecrets, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			apiCfg.PolkaSecrets = append(apiCfg.PolkaSecrets, secret)
+		}
+	}
+	if len(apiCfg.PolkaSecrets) == 0 {
+		if os.Getenv("POLKA_LEGACY_API_KEY") != "true" {
+			log.Println("POLKA_WEBHOOK_SECRETS must be set to verify Polka webhooks")
+			os.Exit(1)
+		}
+		log.Println("warning: Polka webhooks are checked with the static POLKA_KEY only, without signature or replay protection")
+		apiCfg.PolkaLegacyKey = true
+	}
+	apiCfg.LoginIPLimiter = ratelimit.NewBackoff(20, 1*time.Second, 15*time.Minute)
+	apiCfg.LoginAccountLimiter = ratelimit.NewBackoff(5, 1*time.Second, 15*time.Minute)
+	apiCfg.ResetIPLimiter = ratelimit.NewWindow(10, 1*time.Hour)
+	apiCfg.ResetAccountLimiter = ratelimit.NewWindow(3, 1*time.Hour)
+	apiCfg.RejectedWebhookLimiter = ratelimit.NewWindow(20, 1*time.Hour)
+	apiCfg.VerifyIPLimiter = ratelimit.NewWindow(10, 1*time.Hour)
+	apiCfg.VerifyAccountLimiter = ratelimit.NewWindow(3, 1*time.Hour)
+	apiCfg.Hub = pubsub.NewHub()
+	apiCfg.WSTickets = newWSTickets()
+	for _, origin := range strings.Split(os.Getenv("WS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			apiCfg.WSAllowedOrigins = append(apiCfg.WSAllowedOrigins, origin)
+		}
+	}
+	apiCfg.Bus = events.NewBus(256)
+	apiCfg.registerEventHandlers()
+	apiCfg.ChirpLimiters = map[entitlements.Plan]*ratelimit.Window{}
+	for _, plan := range entitlements.Plans {
+		apiCfg.ChirpLimiters[plan] = ratelimit.NewWindow(plan.Limits().ChirpsPerHour, 1*time.Hour)
+	}
+	apiCfg.Mailer = mailer.NewSender(os.Getenv("MAIL_DIR"))
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	fileStorage, err := media.NewFileStorage(mediaDir, "/media")
+	if err != nil {
+		log.Printf("error creating media directory: %s", err)
+		os.Exit(1)
+	}
+	apiCfg.Storage = fileStorage
+	apiCfg.DeletedChirpRetention = 30 * 24 * time.Hour
+	if days, err := strconv.Atoi(os.Getenv("CHIRP_RETENTION_DAYS")); err == nil && days > 0 {
+		apiCfg.DeletedChirpRetention = time.Duration(days) * 24 * time.Hour
+	}
+	apiCfg.ReportHideThreshold = 5
+	if threshold, err := strconv.Atoi(os.Getenv("REPORT_HIDE_THRESHOLD")); err == nil && threshold > 0 {
+		apiCfg.ReportHideThreshold = threshold
+	}
+	apiCfg.PasswordPolicy = auth.DefaultPasswordPolicy
+	if minLength, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil {
+		apiCfg.PasswordPolicy.MinLength = minLength
+	}
+	if os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true" {
+		apiCfg.PasswordPolicy.RequireSymbol = true
+	}
+	argon := auth.DefaultArgon2id
+	if memory, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY_KIB"), 10, 32); err == nil && memory > 0 {
+		argon.Memory = uint32(memory)
+	}
+	if iterations, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil && iterations > 0 {
+		argon.Iterations = uint32(iterations)
+	}
+	if threads, err := strconv.ParseUint(os.Getenv("ARGON2_THREADS"), 10, 8); err == nil && threads > 0 {
+		argon.Threads = uint8(threads)
+	}
+	apiCfg.Hasher = auth.NewPasswordHasher(argon, auth.BcryptHasher{Cost: 10})
+	if os.Getenv("PASSWORD_HASHER") == "bcrypt" {
+		apiCfg.Hasher = auth.NewPasswordHasher(auth.BcryptHasher{Cost: 12}, argon)
+	}
+	if concurrency, err := strconv.Atoi(os.Getenv("PASSWORD_HASH_CONCURRENCY")); err == nil {
+		apiCfg.Hasher.SetConcurrency(concurrency)
+	}
+	apiCfg.DummyHash, err = apiCfg.Hasher.Hash(uuid.NewString())
+	if err != nil {
+		log.Println("error generating dummy password hash")
+		os.Exit(1)
+	}
+	// Static files are served without touching the database; everything else
+	// goes through the account status check.
 	mux := http.ServeMux{}
-	mux.Handle("/app/", http.StripPrefix("/app", apiCfg.middlewareMetricsInc(http.FileServer(http.Dir(".")))))
+	root := http.NewServeMux()
+	root.Handle("/app/", http.StripPrefix("/app", apiCfg.middlewareMetricsInc(http.FileServer(http.Dir(".")))))
+	root.Handle("GET /media/", http.StripPrefix("/media", fileStorage))
+	root.Handle("/", apiCfg.middlewareAccountStatus(&mux))
 	srv := &http.Server{
 		Addr:    ":8090",
-		Handler: &mux,
+		Handler: root,
 	}
 
 	mux.HandleFunc("GET /api/healthz", healthz)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.metrics)
 	mux.HandleFunc("GET /api/chirps", apiCfg.get_chirps)
+	mux.HandleFunc("GET /api/chirps/stream", apiCfg.stream_chirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.get_chirpsID)
 	mux.HandleFunc("POST /admin/reset", apiCfg.reset)
+	mux.HandleFunc("GET /admin/webhooks", apiCfg.admin_list_webhooks)
+	mux.HandleFunc("GET /admin/outbound-webhooks", apiCfg.admin_list_webhook_subscriptions)
+	mux.HandleFunc("POST /admin/outbound-webhooks", apiCfg.admin_create_webhook_subscription)
+	mux.HandleFunc("DELETE /admin/outbound-webhooks/{subscriptionID}", apiCfg.admin_delete_webhook_subscription)
+	mux.HandleFunc("GET /admin/outbound-webhooks/dead-letter", apiCfg.admin_list_dead_deliveries)
+	mux.HandleFunc("POST /admin/outbound-webhooks/dead-letter/{deliveryID}/retry", apiCfg.admin_retry_dead_delivery)
+	mux.HandleFunc("GET /admin/webhooks/{deliveryID}", apiCfg.admin_get_webhook)
+	mux.HandleFunc("GET /admin/chirps/deleted", apiCfg.admin_list_deleted_chirps)
+	mux.HandleFunc("POST /admin/chirps/{chirpID}/restore", apiCfg.admin_restore_chirp)
+	mux.HandleFunc("GET /admin/moderation", apiCfg.admin_moderation_queue)
+	mux.HandleFunc("GET /admin/moderation/{chirpID}", apiCfg.admin_review_chirp)
+	mux.HandleFunc("POST /admin/moderation/{chirpID}", apiCfg.admin_moderate_chirp)
+	mux.HandleFunc("GET /admin/audit-log", apiCfg.admin_list_audit_log)
+	mux.HandleFunc("GET /admin/users", apiCfg.admin_search_users)
+	mux.HandleFunc("GET /admin/users/{userID}", apiCfg.admin_get_user)
+	mux.HandleFunc("GET /admin/users/{userID}/sessions", apiCfg.admin_list_sessions)
+	mux.HandleFunc("POST /admin/users/{userID}/suspend", apiCfg.admin_suspend_user)
+	mux.HandleFunc("POST /admin/users/{userID}/unsuspend", apiCfg.admin_unsuspend_user)
+	mux.HandleFunc("POST /admin/users/{userID}/logout", apiCfg.admin_logout_user)
+	mux.HandleFunc("PUT /admin/users/{userID}/chirpy-red", apiCfg.admin_set_chirpy_red)
+	mux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.admin_set_role)
+	mux.HandleFunc("POST /admin/webhooks/{deliveryID}/replay", apiCfg.admin_replay_webhook)
 	mux.HandleFunc("POST /api/chirps", apiCfg.chirps)
 	mux.HandleFunc("POST /api/users", apiCfg.add_user)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.verify_email)
+	mux.HandleFunc("POST /api/verify_email/resend", apiCfg.resend_verification_email)
+	mux.HandleFunc("GET /api/users/{userID}", apiCfg.get_user)
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.delete_account)
+	mux.HandleFunc("GET /api/users/me/export", apiCfg.export_account)
+	mux.HandleFunc("GET /api/users/by-handle/{handle}", apiCfg.get_user_by_handle)
+	mux.HandleFunc("PUT /api/users/profile", apiCfg.update_profile)
+	mux.HandleFunc("PUT /api/users/handle", apiCfg.rename_handle)
+	mux.HandleFunc("POST /api/users/avatar", apiCfg.upload_avatar)
+	mux.HandleFunc("POST /api/users/{userID}/block", apiCfg.block_user)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.unblock_user)
+	mux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.mute_user)
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.unmute_user)
+	mux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.follow_user)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.unfollow_user)
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.create_oauth_client)
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.list_oauth_clients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.delete_oauth_client)
+	mux.HandleFunc("GET /api/oauth/authorizations", apiCfg.list_oauth_authorizations)
+	mux.HandleFunc("DELETE /api/oauth/authorizations/{clientID}", apiCfg.revoke_oauth_authorization)
+	mux.HandleFunc("POST /api/api-keys", apiCfg.create_api_key)
+	mux.HandleFunc("GET /api/api-keys", apiCfg.list_api_keys)
+	mux.HandleFunc("DELETE /api/api-keys/{keyID}", apiCfg.revoke_api_key)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.oauth_authorize_info)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.oauth_authorize)
+	mux.HandleFunc("POST /oauth/token", apiCfg.oauth_token)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.oauth_revoke)
+	mux.HandleFunc("POST /api/password-reset/request", apiCfg.request_password_reset)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.confirm_password_reset)
 	mux.HandleFunc("POST /api/login", apiCfg.login)
+	mux.HandleFunc("POST /api/login/2fa", apiCfg.login_2fa)
+	mux.HandleFunc("POST /api/users/2fa/setup", apiCfg.setup_2fa)
+	mux.HandleFunc("POST /api/users/2fa/confirm", apiCfg.confirm_2fa)
 	mux.HandleFunc("POST /api/refresh", apiCfg.refresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.revoke)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.upgrade_user)
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.polka_webhooks)
+	mux.HandleFunc("GET /api/ws", apiCfg.websocket)
+	mux.HandleFunc("POST /api/ws/ticket", apiCfg.websocket_ticket)
+	mux.HandleFunc("GET /api/notifications", apiCfg.list_notifications)
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.read_notifications)
+	mux.HandleFunc("GET /api/notifications/unread-count", apiCfg.count_unread_notifications)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.edit_chirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.delete_chirps)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", apiCfg.report_chirp)
 
-	log.Fatal(srv.ListenAndServe())
+	apiCfg.startBackgroundJobs(context.Background())
 
-}
-
-func (cfg *apiConfig) upgrade_user(writer http.ResponseWriter, request *http.Request) {
-	type useridjson struct {
-		UserId uuid.UUID `json:"user_id"`
-	}
-	type incomming struct {
-		Event string     `json:"event"`
-		Data  useridjson `json:"data"`
-	}
-	recievedApiKey, err := auth.GetAPIKey(request.Header)
-	if err != nil {
-		respondWithError(writer, 401, "error retrieving the key")
-		return
-	}
-	if recievedApiKey != cfg.PolkaKKey {
-		respondWithError(writer, 401, "Incorrect API key")
-		return
-	}
-	decoder := json.NewDecoder(request.Body)
-	inc := incomming{}
-	err = decoder.Decode(&inc)
-	if err != nil {
-		respondWithError(writer, 404, "error decoding the incomming json")
-		return
-	}
-	if inc.Event != "user.upgraded" {
-		respondWithJSON(writer, 204, nil)
-		return
-	}
-	err = cfg.Queries.UpgrateToChirpyRed(request.Context(), inc.Data.UserId)
-	if err != nil {
-		respondWithError(writer, 404, "error upgrading user")
-		return
-	}
-	type returnstruct struct {
-		Body string `json:"body"`
-	}
-	returning := returnstruct{
-		Body: "",
-	}
-	respondWithJSON(writer, 204, returning)
+	log.Fatal(srv.ListenAndServe())
 
 }
 
@@ -112,17 +244,12 @@ func (cfg *apiConfig) delete_chirps(writer http.ResponseWriter, request *http.Re
 		respondWithError(writer, 401, "error during chirp IDD parsing")
 		return
 	}
-	chirpStruct, err := cfg.Queries.GetChirpFromID(request.Context(), uuidID)
+	chirpStruct, err := cfg.Queries.GetChirpForAuthor(request.Context(), uuidID)
 	if err != nil {
 		respondWithError(writer, 401, "error retrieving chirp from database")
 		return
 	}
-	token, err := auth.GetBearerToken(request.Header)
-	if err != nil {
-		respondWithError(writer, 401, "error during token retrieval")
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.SecretToken)
+	userID, err := cfg.authenticate(request, auth.ScopeChirpsWrite)
 	if err != nil {
 		respondWithError(writer, 401, "error validating token")
 		return
@@ -132,11 +259,35 @@ func (cfg *apiConfig) delete_chirps(writer http.ResponseWriter, request *http.Re
 		return
 	}
 
-	err = cfg.Queries.DeleteChirp(request.Context(), chirpStruct.ID)
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
 	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	deleted, err := queries.SoftDeleteChirp(request.Context(), database.SoftDeleteChirpParams{
+		ID:        chirpStruct.ID,
+		DeletedBy: uuid.NullUUID{UUID: userID, Valid: true},
+	})
+	if err != nil || deleted == 0 {
 		respondWithError(writer, 404, "Chirp not found")
 		return
 	}
+	type deletedjson struct {
+		Id      uuid.UUID `json:"id"`
+		User_id uuid.UUID `json:"user_id"`
+	}
+	err = enqueueWebhookEvent(request.Context(), queries, eventChirpDeleted, deletedjson{Id: chirpStruct.ID, User_id: chirpStruct.UserID})
+	if err != nil {
+		respondWithError(writer, 500, "error queueing webhook")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error deleting chirp")
+		return
+	}
 	respondWithJSON(writer, 204, nil)
 }
 
@@ -165,6 +316,11 @@ func (cfg *apiConfig) refresh(writer http.ResponseWriter, request *http.Request)
 		respondWithError(writer, 401, "error durig retrieval of the user")
 		return
 	}
+	if user.ClientID.Valid {
+		// refresh tokens issued to OAuth clients are only valid at /oauth/token
+		respondWithError(writer, 401, "error durig retrieval of the user")
+		return
+	}
 	if user.RevokedAt.Valid {
 		respondWithError(writer, 401, "refresh token expired")
 		return
@@ -173,6 +329,15 @@ func (cfg *apiConfig) refresh(writer http.ResponseWriter, request *http.Request)
 		respondWithError(writer, 401, "Refresh token exipred")
 		return
 	}
+	suspension, err := cfg.Queries.GetAccountStatus(request.Context(), user.UserID)
+	if err != nil {
+		respondWithError(writer, 401, "error durig retrieval of the user")
+		return
+	}
+	if suspension.SuspendedAt.Valid {
+		respondAccountSuspended(writer, suspension.SuspensionReason.String)
+		return
+	}
 	type ReturnStruct struct {
 		Token string `json:"token"`
 	}
@@ -206,16 +371,67 @@ func (cfg *apiConfig) login(writer http.ResponseWriter, request *http.Request) {
 		respondWithError(writer, 400, "something went wrong decoding the request")
 		return
 	}
+	ipKey := clientIP(request)
+	accountKey := strings.ToLower(strings.TrimSpace(incom.Email))
+	if wait, ok := cfg.LoginIPLimiter.Allow(ipKey); !ok {
+		respondTooManyRequests(writer, wait)
+		return
+	}
+	defer cfg.LoginIPLimiter.Done(ipKey)
+	if wait, ok := cfg.LoginAccountLimiter.Allow(accountKey); !ok {
+		respondTooManyRequests(writer, wait)
+		return
+	}
+	defer cfg.LoginAccountLimiter.Done(accountKey)
 	user, err := cfg.Queries.ReturnUserByEmail(request.Context(), incom.Email)
 	if err != nil {
-		respondWithError(writer, 401, "incorrect email")
+		// compare against a dummy hash so unknown emails take as long as known ones
+		cfg.Hasher.Verify(incom.Password, cfg.DummyHash)
+		cfg.LoginIPLimiter.Fail(ipKey)
+		cfg.LoginAccountLimiter.Fail(accountKey)
+		respondWithError(writer, 401, "incorrect email or password")
 		return
 	}
-	err = auth.CheckPasswordHash(incom.Password, user.HashedPassword)
+	rehash, err := cfg.Hasher.Verify(incom.Password, user.HashedPassword)
 	if err != nil {
-		respondWithError(writer, 401, "incorrect password")
+		cfg.LoginIPLimiter.Fail(ipKey)
+		cfg.LoginAccountLimiter.Fail(accountKey)
+		respondWithError(writer, 401, "incorrect email or password")
 		return
 	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(writer, 403, "email address not verified")
+		return
+	}
+	if user.SuspendedAt.Valid {
+		respondAccountSuspended(writer, user.SuspensionReason.String)
+		return
+	}
+	if rehash {
+		cfg.upgradePasswordHash(request.Context(), user.ID, incom.Password)
+	}
+	cfg.LoginAccountLimiter.Reset(accountKey)
+	if user.TotpEnabledAt.Valid {
+		cfg.respondWithTwoFactorChallenge(writer, user)
+		return
+	}
+	cfg.respondWithSession(writer, request, user)
+}
+
+// respondWithSession issues a new access and refresh token pair for user.
+func (cfg *apiConfig) respondWithSession(writer http.ResponseWriter, request *http.Request, user database.User) {
+	if user.SuspendedAt.Valid {
+		respondAccountSuspended(writer, user.SuspensionReason.String)
+		return
+	}
+	if user.DeletionRequestedAt.Valid {
+		// Logging in during the grace period keeps the account.
+		err := cfg.Queries.CancelAccountDeletion(request.Context(), user.ID)
+		if err != nil {
+			respondWithError(writer, 500, "error restoring account")
+			return
+		}
+	}
 	Authtoken, err := auth.MakeJWT(user.ID, cfg.SecretToken, 1*time.Hour)
 	if err != nil {
 		respondWithError(writer, 401, "error during auth token generation")
@@ -254,7 +470,47 @@ func (cfg *apiConfig) login(writer http.ResponseWriter, request *http.Request) {
 		IsChirpyRed: user.IsChirpyRed,
 	}
 	respondWithJSON(writer, 200, returnJson)
+}
 
+// upgradePasswordHash stores a fresh hash for a user whose stored hash uses an
+// outdated algorithm or parameters. Failures only get logged, the login
+// itself already succeeded.
+func (cfg *apiConfig) upgradePasswordHash(ctx context.Context, userID uuid.UUID, password string) {
+	newHash, err := cfg.Hasher.Hash(password)
+	if err != nil {
+		log.Printf("error rehashing password for %s: %s", userID, err)
+		return
+	}
+	params := database.UpdateUserPasswordParams{
+		HashedPassword: newHash,
+		ID:             userID,
+	}
+	err = cfg.Queries.UpdateUserPassword(ctx, params)
+	if err != nil {
+		log.Printf("error storing rehashed password for %s: %s", userID, err)
+	}
+}
+
+// authenticate validates the bearer access token or personal API key of
+// request. Tokens issued to third-party OAuth clients and API keys are only
+// accepted when they were granted scope; an empty scope restricts the
+// endpoint to first-party tokens.
+func (cfg *apiConfig) authenticate(request *http.Request, scope string) (uuid.UUID, error) {
+	if _, err := auth.GetAPIKey(request.Header); err == nil {
+		return cfg.authenticateAPIKey(request, scope)
+	}
+	token, err := auth.GetBearerToken(request.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	access, err := auth.ValidateAccessToken(token, cfg.SecretToken)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if access.ClientID != "" && (scope == "" || !access.HasScope(scope)) {
+		return uuid.Nil, auth.ErrInsufficientScope
+	}
+	return access.UserID, nil
 }
 
 func (cfg *apiConfig) get_chirpsID(writer http.ResponseWriter, request *http.Request) {
@@ -269,12 +525,42 @@ func (cfg *apiConfig) get_chirpsID(writer http.ResponseWriter, request *http.Req
 		respondWithError(writer, 404, "chirp not found")
 		return
 	}
+	filter, err := cfg.requestChirpFilter(request)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving chirp")
+		return
+	}
+	if !filter.allows(chirp.UserID) {
+		respondWithError(writer, 404, "chirp not found")
+		return
+	}
+	if chirp.PublishAt.After(time.Now()) {
+		// Scheduled chirps are only visible to their author until they go out.
+		userID, err := cfg.authenticate(request, auth.ScopeChirpsRead)
+		if err != nil || userID != chirp.UserID {
+			respondWithError(writer, 404, "chirp not found")
+			return
+		}
+	}
 	type returnjason struct {
-		Id         uuid.UUID `json:"id"`
-		Created_at time.Time `json:"created_at"`
-		Updated_at time.Time `json:"updated_at"`
-		Body       string    `json:"body"`
-		User_id    uuid.UUID `json:"user_id"`
+		Id         uuid.UUID   `json:"id"`
+		Created_at time.Time   `json:"created_at"`
+		Updated_at time.Time   `json:"updated_at"`
+		Body       string      `json:"body"`
+		User_id    uuid.UUID   `json:"user_id"`
+		Publish_at time.Time   `json:"publish_at"`
+		Media      []mediaJSON `json:"media"`
+		Author     authorJSON  `json:"author"`
+	}
+	attachments, err := cfg.mediaForChirps(request.Context(), []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving media")
+		return
+	}
+	authors, err := cfg.authorsForChirps(request.Context(), []database.Chirp{chirp})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving author")
+		return
 	}
 	daJsonMan := returnjason{
 		Id:         chirp.ID,
@@ -282,6 +568,9 @@ func (cfg *apiConfig) get_chirpsID(writer http.ResponseWriter, request *http.Req
 		Updated_at: chirp.UpdatedAt,
 		Body:       chirp.Body,
 		User_id:    chirp.UserID,
+		Publish_at: chirp.PublishAt,
+		Media:      attachments[chirp.ID],
+		Author:     authors[chirp.UserID],
 	}
 	respondWithJSON(writer, 200, daJsonMan)
 }
@@ -304,17 +593,35 @@ func (cfg *apiConfig) get_chirps(writer http.ResponseWriter, request *http.Reque
 			return
 		}
 	}
+	filter, err := cfg.requestChirpFilter(request)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving chirps")
+		return
+	}
+	chirps = filter.apply(chirps)
 	type returnjason struct {
-		Id         uuid.UUID `json:"id"`
-		Created_at time.Time `json:"created_at"`
-		Updated_at time.Time `json:"updated_at"`
-		Body       string    `json:"body"`
-		User_id    uuid.UUID `json:"user_id"`
+		Id         uuid.UUID   `json:"id"`
+		Created_at time.Time   `json:"created_at"`
+		Updated_at time.Time   `json:"updated_at"`
+		Body       string      `json:"body"`
+		User_id    uuid.UUID   `json:"user_id"`
+		Media      []mediaJSON `json:"media"`
+		Author     authorJSON  `json:"author"`
 	}
 	var returning []returnjason
 	if sortType == "desc" {
 		slices.Reverse(chirps)
 	}
+	attachments, err := cfg.mediaForChirps(request.Context(), chirps)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving media")
+		return
+	}
+	authors, err := cfg.authorsForChirps(request.Context(), chirps)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving authors")
+		return
+	}
 	for _, chirp := range chirps {
 		daJsonMan := returnjason{
 			Id:         chirp.ID,
@@ -322,70 +629,136 @@ func (cfg *apiConfig) get_chirps(writer http.ResponseWriter, request *http.Reque
 			Updated_at: chirp.UpdatedAt,
 			Body:       chirp.Body,
 			User_id:    chirp.UserID,
+			Media:      attachments[chirp.ID],
+			Author:     authors[chirp.UserID],
 		}
 		returning = append(returning, daJsonMan)
 	}
 	respondWithJSON(writer, 200, returning)
 }
 
+type chirpParameters struct {
+	Chirp     string     `json:"body"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
 func (cfg *apiConfig) chirps(writer http.ResponseWriter, request *http.Request) {
-	type parameters struct {
-		Chirp string `json:"body"`
-	}
-	token, err := auth.GetBearerToken(request.Header)
+	userID, err := cfg.authenticate(request, auth.ScopeChirpsWrite)
 	if err != nil {
 		respondWithError(writer, 401, "incorrect or missing login token")
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.SecretToken)
+	// Throttle before reading the body, so rejected clients never get their
+	// images decoded.
+	plan, err := cfg.planForUser(request.Context(), userID)
 	if err != nil {
 		respondWithError(writer, 401, "unknown user")
 		return
 	}
-	decoder := json.NewDecoder(request.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(writer, 400, "something went wrong")
+	if wait, ok := cfg.ChirpLimiters[plan].Allow(userID.String()); !ok {
+		respondTooManyRequests(writer, wait)
+		return
+	}
+	params := chirpParameters{}
+	var images []media.Image
+	if isMultipart(request) {
+		var ok bool
+		params, images, ok = parseMultipartChirp(writer, request)
+		if !ok {
+			return
+		}
+	} else {
+		decoder := json.NewDecoder(request.Body)
+		err = decoder.Decode(&params)
+		if err != nil {
+			respondWithError(writer, 400, "something went wrong")
+			return
+		}
+	}
+	if !cfg.checkChirpLength(writer, plan, params.Chirp) {
 		return
 	}
-	validated_Chirp, err := validate_chirp(params.Chirp)
+	publishAt := time.Now().UTC()
+	if params.PublishAt != nil && params.PublishAt.After(publishAt) {
+		if !plan.Allows(entitlements.ScheduledChirps) {
+			respondWithUpgradeRequired(writer, entitlements.ScheduledChirps)
+			return
+		}
+		if params.PublishAt.After(publishAt.Add(plan.Limits().MaxScheduleAhead)) {
+			respondWithError(writer, 400, "chirp scheduled too far ahead")
+			return
+		}
+		publishAt = params.PublishAt.UTC()
+	}
+	validated_Chirp, err := validate_chirp(params.Chirp, plan.Limits().MaxChirpLength)
 	if err != nil {
 		respondWithError(writer, 400, "something went wrong")
-
+		return
 	}
 	chirpParams := database.CreateChirpParams{
-		Body:   validated_Chirp,
-		UserID: userID,
+		Body:      validated_Chirp,
+		UserID:    userID,
+		PublishAt: publishAt,
+	}
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
 	}
-	chirp, err := cfg.Queries.CreateChirp(request.Context(), chirpParams)
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	chirp, err := queries.CreateChirp(request.Context(), chirpParams)
 	if err != nil {
 		respondWithError(writer, 400, "something went wrong")
-
+		return
 	}
-	type returnjason struct {
-		Id         uuid.UUID `json:"id"`
-		Created_at time.Time `json:"created_at"`
-		Updated_at time.Time `json:"updated_at"`
-		Body       string    `json:"body"`
-		User_id    uuid.UUID `json:"user_id"`
+	attached, keys, err := cfg.attachMedia(request.Context(), queries, chirp.ID, images)
+	if err != nil {
+		cfg.deleteStoredMedia(request.Context(), keys)
+		respondWithError(writer, 500, "error storing media")
+		return
+	}
+	authors, err := cfg.authorsForChirps(request.Context(), []database.Chirp{chirp})
+	if err != nil {
+		authors = map[uuid.UUID]authorJSON{chirp.UserID: {Id: chirp.UserID}}
 	}
-	returning := returnjason{
+	returning := streamedChirp{
 		Id:         chirp.ID,
 		Created_at: chirp.CreatedAt,
 		Updated_at: chirp.UpdatedAt,
 		Body:       chirp.Body,
 		User_id:    chirp.UserID,
+		Publish_at: chirp.PublishAt,
+		Media:      attached,
+		Author:     authors[chirp.UserID],
+	}
+	if !chirp.PublishAt.After(chirp.CreatedAt) {
+		// Scheduled chirps are announced by publishScheduledChirps once live.
+		err = enqueueWebhookEvent(request.Context(), queries, eventChirpCreated, returning)
+		if err != nil {
+			cfg.deleteStoredMedia(request.Context(), keys)
+			respondWithError(writer, 500, "error queueing webhook")
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		cfg.deleteStoredMedia(request.Context(), keys)
+		respondWithError(writer, 500, "error saving chirp")
+		return
+	}
+	if !chirp.PublishAt.After(chirp.CreatedAt) {
+		cfg.emit(request.Context(), busChirpPublished, chirp)
 	}
 	respondWithJSON(writer, 201, returning)
 
 }
 
-func validate_chirp(chirp string) (string, error) {
+func validate_chirp(chirp string, maxLength int) (string, error) {
 	type returnValsTrue struct {
 		NewChirp string `json:"cleaned_body"`
 	}
-	if len(chirp) > 140 {
+	if len(chirp) > maxLength {
 		return "", errors.New("chirp to long")
 	}
 	cleanedChirp := checkForProfanity(chirp)
@@ -396,6 +769,9 @@ func validate_chirp(chirp string) (string, error) {
 }
 
 func (cfg *apiConfig) metrics(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
 	printValue := []byte(fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", cfg.fileserverHits.Load()))
 	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
 	writer.WriteHeader(200)
@@ -403,6 +779,9 @@ func (cfg *apiConfig) metrics(writer http.ResponseWriter, request *http.Request)
 }
 
 func (cfg *apiConfig) reset(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
 	if cfg.PLATFORM != "dev" {
 		respondWithError(writer, 403, "Forbidden")
 		return
@@ -427,7 +806,7 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 func (cfg *apiConfig) add_user(writer http.ResponseWriter, request *http.Request) {
 	type incomming struct {
 		Email    string `json:"email"`
-		Password string `jason:"password"`
+		Password string `json:"password"`
 	}
 	type User struct {
 		ID          uuid.UUID `json:"id"`
@@ -445,7 +824,17 @@ func (cfg *apiConfig) add_user(writer http.ResponseWriter, request *http.Request
 		respondWithError(writer, 500, "Somthing went wrong")
 		return
 	}
-	hashed_password, err := auth.HashPassword(inc.Password)
+	err = auth.ValidateEmail(inc.Email)
+	if err != nil {
+		respondWithError(writer, 400, err.Error())
+		return
+	}
+	err = cfg.PasswordPolicy.Validate(inc.Password)
+	if err != nil {
+		respondWithError(writer, 400, err.Error())
+		return
+	}
+	hashed_password, err := cfg.Hasher.Hash(inc.Password)
 	if err != nil {
 		respondWithError(writer, 500, "Something went wrong during password hash")
 		return
@@ -455,11 +844,36 @@ func (cfg *apiConfig) add_user(writer http.ResponseWriter, request *http.Request
 		Email:          inc.Email,
 		HashedPassword: inc.Password,
 	}
-	DBuser, err := cfg.Queries.CreateUser(request.Context(), userss)
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	DBuser, err := queries.CreateUser(request.Context(), userss)
 	if err != nil {
 		respondWithError(writer, 400, "something went wrong with creation of user")
 		return
 	}
+	type createdjson struct {
+		Id         uuid.UUID `json:"id"`
+		Created_at time.Time `json:"created_at"`
+	}
+	err = enqueueWebhookEvent(request.Context(), queries, eventUserCreated, createdjson{Id: DBuser.ID, Created_at: DBuser.CreatedAt})
+	if err != nil {
+		respondWithError(writer, 500, "error queueing webhook")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "something went wrong with creation of user")
+		return
+	}
+	err = cfg.sendVerificationEmail(request.Context(), DBuser)
+	if err != nil {
+		log.Printf("error sending verification email to %s: %s", DBuser.Email, err)
+	}
 	user := User{
 		ID:          DBuser.ID,
 		CreatedAt:   DBuser.CreatedAt,
@@ -473,10 +887,44 @@ func (cfg *apiConfig) add_user(writer http.ResponseWriter, request *http.Request
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	DB             *sql.DB
 	Queries        *database.Queries
 	PLATFORM       string
 	SecretToken    string
 	PolkaKKey      string
+	PolkaSecrets   []string
+	AdminKey       string
+
+	LoginIPLimiter      *ratelimit.Backoff
+	LoginAccountLimiter *ratelimit.Backoff
+	ResetIPLimiter      *ratelimit.Window
+	ResetAccountLimiter *ratelimit.Window
+	ChirpLimiters       map[entitlements.Plan]*ratelimit.Window
+	Hub                 pubsub.Broker
+	Bus                 *events.Bus
+	Storage             media.Storage
+	DummyHash           string
+	PasswordPolicy      auth.PasswordPolicy
+	Hasher              *auth.PasswordHasher
+	Mailer              mailer.Sender
+	// DeletedChirpRetention is how long soft deleted chirps can be restored.
+	DeletedChirpRetention time.Duration
+	// ReportHideThreshold is the number of open reports that hides a chirp
+	// until a moderator has looked at it.
+	ReportHideThreshold int
+	// RejectedWebhookLimiter caps how many unauthenticated webhook
+	// deliveries one IP can write to the delivery log.
+	RejectedWebhookLimiter *ratelimit.Window
+	// WSAllowedOrigins lists the browser origins that may open a WebSocket.
+	WSAllowedOrigins []string
+	WSTickets        *wsTickets
+	// PolkaLegacyKey accepts the static Polka ApiKey header instead of a
+	// signature. It is only set when POLKA_LEGACY_API_KEY opts in.
+	PolkaLegacyKey bool
+	// VerifyIPLimiter and VerifyAccountLimiter throttle verification email
+	// resends per client and per address.
+	VerifyIPLimiter      *ratelimit.Window
+	VerifyAccountLimiter *ratelimit.Window
 }
 
 func respondWithError(w http.ResponseWriter, code int, msg string) {
@@ -496,6 +944,20 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 	w.Write(dat)
 }
 
+func respondTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(wait.Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, 429, "too many attempts, try again later")
+}
+
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
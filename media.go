@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/media"
+	"github.com/google/uuid"
+)
+
+const maxChirpMedia = 4
+
+type mediaJSON struct {
+	Id            uuid.UUID `json:"id"`
+	Url           string    `json:"url"`
+	Thumbnail_url string    `json:"thumbnail_url"`
+	Content_type  string    `json:"content_type"`
+	Width         int32     `json:"width"`
+	Height        int32     `json:"height"`
+}
+
+func (cfg *apiConfig) toMediaJSON(attachment database.MediaAttachment) mediaJSON {
+	return mediaJSON{
+		Id:            attachment.ID,
+		Url:           cfg.Storage.URL(attachment.StorageKey),
+		Thumbnail_url: cfg.Storage.URL(attachment.ThumbnailKey),
+		Content_type:  attachment.ContentType,
+		Width:         attachment.Width,
+		Height:        attachment.Height,
+	}
+}
+
+// mediaForChirps loads the attachments of several chirps at once, keyed by
+// chirp. Chirps without media map to an empty slice.
+func (cfg *apiConfig) mediaForChirps(ctx context.Context, chirps []database.Chirp) (map[uuid.UUID][]mediaJSON, error) {
+	ids := make([]uuid.UUID, 0, len(chirps))
+	byChirp := map[uuid.UUID][]mediaJSON{}
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+		byChirp[chirp.ID] = []mediaJSON{}
+	}
+	if len(ids) == 0 {
+		return byChirp, nil
+	}
+	attachments, err := cfg.Queries.ListMediaForChirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		byChirp[attachment.ChirpID] = append(byChirp[attachment.ChirpID], cfg.toMediaJSON(attachment))
+	}
+	return byChirp, nil
+}
+
+// parseMultipartChirp reads a chirp posted as multipart/form-data with a
+// body field, an optional RFC 3339 publish_at field and up to four media
+// files. It writes the error response itself when ok is false.
+func parseMultipartChirp(writer http.ResponseWriter, request *http.Request) (params chirpParameters, images []media.Image, ok bool) {
+	request.Body = http.MaxBytesReader(writer, request.Body, maxChirpMedia*media.MaxImageBytes+1<<20)
+	err := request.ParseMultipartForm(8 << 20)
+	if err != nil {
+		respondWithError(writer, 413, "upload too large")
+		return params, nil, false
+	}
+	defer request.MultipartForm.RemoveAll()
+	params.Chirp = request.FormValue("body")
+	if raw := request.FormValue("publish_at"); raw != "" {
+		publishAt, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondWithError(writer, 400, "publish_at must be an RFC 3339 timestamp")
+			return params, nil, false
+		}
+		params.PublishAt = &publishAt
+	}
+	files := request.MultipartForm.File["media"]
+	if len(files) > maxChirpMedia {
+		respondWithError(writer, 400, "a chirp can have at most 4 media attachments")
+		return params, nil, false
+	}
+	for _, header := range files {
+		if header.Size > media.MaxImageBytes {
+			respondWithError(writer, 413, "media file too large")
+			return params, nil, false
+		}
+		file, err := header.Open()
+		if err != nil {
+			respondWithError(writer, 400, "error reading media file")
+			return params, nil, false
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			respondWithError(writer, 400, "error reading media file")
+			return params, nil, false
+		}
+		img, err := media.Process(data)
+		switch {
+		case errors.Is(err, media.ErrUnsupportedType):
+			respondWithError(writer, 415, "media must be a JPEG, PNG, GIF or WebP image")
+			return params, nil, false
+		case errors.Is(err, media.ErrTooLarge):
+			respondWithError(writer, 413, "media file too large")
+			return params, nil, false
+		case err != nil:
+			respondWithError(writer, 400, "invalid media file")
+			return params, nil, false
+		}
+		images = append(images, img)
+	}
+	return params, images, true
+}
+
+func isMultipart(request *http.Request) bool {
+	return strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data")
+}
+
+// attachMedia stores images and records them against chirpID using queries,
+// normally bound to the transaction that created the chirp. It returns the
+// storage keys written so the caller can clean up if that transaction fails.
+func (cfg *apiConfig) attachMedia(ctx context.Context, queries *database.Queries, chirpID uuid.UUID, images []media.Image) ([]mediaJSON, []string, error) {
+	attached := []mediaJSON{}
+	keys := []string{}
+	for position, img := range images {
+		id := uuid.NewString()
+		key := id + "." + img.Ext
+		thumbnailKey := id + "_thumb." + img.ThumbnailExt
+		err := cfg.Storage.Put(ctx, key, img.ContentType, img.Data)
+		if err != nil {
+			return nil, keys, err
+		}
+		keys = append(keys, key)
+		err = cfg.Storage.Put(ctx, thumbnailKey, img.ThumbnailType, img.Thumbnail)
+		if err != nil {
+			return nil, keys, err
+		}
+		keys = append(keys, thumbnailKey)
+		attachment, err := queries.CreateMediaAttachment(ctx, database.CreateMediaAttachmentParams{
+			ChirpID:      chirpID,
+			Position:     int32(position),
+			ContentType:  img.ContentType,
+			Width:        int32(img.Width),
+			Height:       int32(img.Height),
+			SizeBytes:    int32(len(img.Data)),
+			StorageKey:   key,
+			ThumbnailKey: thumbnailKey,
+		})
+		if err != nil {
+			return nil, keys, err
+		}
+		attached = append(attached, cfg.toMediaJSON(attachment))
+	}
+	return attached, keys, nil
+}
+
+func (cfg *apiConfig) deleteStoredMedia(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		cfg.Storage.Delete(ctx, key)
+	}
+}
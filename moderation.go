@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "sexual", "misinformation", "other"}
+
+const maxReportDetailsLength = 1000
+
+// audit records an action in the audit log. Pass the transaction's queries
+// so the entry is only kept when the action commits. actor is invalid for
+// actions taken by the system.
+func audit(ctx context.Context, queries *database.Queries, actor uuid.NullUUID, action, targetType string, targetID uuid.UUID, details interface{}) error {
+	if details == nil {
+		details = struct{}{}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return queries.CreateAuditLogEntry(ctx, database.CreateAuditLogEntryParams{
+		ActorID:    actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    data,
+	})
+}
+
+func (cfg *apiConfig) report_chirp(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	chirpID, err := uuid.Parse(request.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	chirp, err := cfg.Queries.GetChirpFromID(request.Context(), chirpID)
+	if err != nil {
+		respondWithError(writer, 404, "chirp not found")
+		return
+	}
+	if chirp.UserID == userID {
+		respondWithError(writer, 400, "you cannot report your own chirp")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	if !slices.Contains(reportReasons, inc.Reason) {
+		respondWithError(writer, 400, "reason must be one of "+strings.Join(reportReasons, ", "))
+		return
+	}
+	if len(inc.Details) > maxReportDetailsLength {
+		respondWithError(writer, 400, "details too long")
+		return
+	}
+	report, err := cfg.Queries.CreateReport(request.Context(), database.CreateReportParams{
+		ChirpID:    chirp.ID,
+		ReporterID: userID,
+		Reason:     inc.Reason,
+		Details:    strings.TrimSpace(inc.Details),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, 409, "you already reported this chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 500, "error saving report")
+		return
+	}
+	cfg.autoHide(request.Context(), chirp.ID)
+	type returnjason struct {
+		Id         uuid.UUID `json:"id"`
+		Created_at time.Time `json:"created_at"`
+		Chirp_id   uuid.UUID `json:"chirp_id"`
+		Reason     string    `json:"reason"`
+	}
+	respondWithJSON(writer, 201, returnjason{
+		Id:         report.ID,
+		Created_at: report.CreatedAt,
+		Chirp_id:   report.ChirpID,
+		Reason:     report.Reason,
+	})
+}
+
+// autoHide hides a chirp once its open reports reach the threshold, until a
+// moderator reviews it. Failures are logged, the report itself was saved.
+func (cfg *apiConfig) autoHide(ctx context.Context, chirpID uuid.UUID) {
+	open, err := cfg.Queries.CountOpenReports(ctx, chirpID)
+	if err != nil || open < int64(cfg.ReportHideThreshold) {
+		return
+	}
+	hidden, err := cfg.Queries.AutoHideChirp(ctx, chirpID)
+	if err == nil && hidden > 0 {
+		type details struct {
+			Open_reports int64 `json:"open_reports"`
+		}
+		err = audit(ctx, cfg.Queries, uuid.NullUUID{}, "chirp.auto_hide", "chirp", chirpID, details{Open_reports: open})
+	}
+	if err != nil {
+		log.Printf("error hiding reported chirp %s: %s", chirpID, err)
+	}
+}
+
+func (cfg *apiConfig) admin_moderation_queue(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireRole(writer, request, roleModerator); !ok {
+		return
+	}
+	limit, offset := pagination(request)
+	queue, err := cfg.Queries.ListModerationQueue(request.Context(), database.ListModerationQueueParams{
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving moderation queue")
+		return
+	}
+	type returnjason struct {
+		Chirp_id          uuid.UUID `json:"chirp_id"`
+		Body              string    `json:"body"`
+		User_id           uuid.UUID `json:"user_id"`
+		Hidden            bool      `json:"hidden"`
+		Deleted           bool      `json:"deleted"`
+		Report_count      int64     `json:"report_count"`
+		First_reported_at time.Time `json:"first_reported_at"`
+		Reasons           []string  `json:"reasons"`
+	}
+	returning := []returnjason{}
+	for _, item := range queue {
+		returning = append(returning, returnjason{
+			Chirp_id:          item.ID,
+			Body:              item.Body,
+			User_id:           item.UserID,
+			Hidden:            item.HiddenAt.Valid,
+			Deleted:           item.DeletedAt.Valid,
+			Report_count:      item.ReportCount,
+			First_reported_at: item.FirstReportedAt,
+			Reasons:           item.Reasons,
+		})
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+type auditLogJSON struct {
+	Id          uuid.UUID       `json:"id"`
+	Created_at  time.Time       `json:"created_at"`
+	Actor_id    *uuid.UUID      `json:"actor_id"`
+	Action      string          `json:"action"`
+	Target_type string          `json:"target_type"`
+	Target_id   uuid.UUID       `json:"target_id"`
+	Details     json.RawMessage `json:"details"`
+}
+
+func toAuditLogJSON(entry database.AuditLog) auditLogJSON {
+	returning := auditLogJSON{
+		Id:          entry.ID,
+		Created_at:  entry.CreatedAt,
+		Action:      entry.Action,
+		Target_type: entry.TargetType,
+		Target_id:   entry.TargetID,
+		Details:     entry.Details,
+	}
+	if entry.ActorID.Valid {
+		returning.Actor_id = &entry.ActorID.UUID
+	}
+	return returning
+}
+
+// admin_review_chirp shows a reported chirp, whatever its state, with its
+// reports and the moderation history.
+func (cfg *apiConfig) admin_review_chirp(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireRole(writer, request, roleModerator); !ok {
+		return
+	}
+	chirpID, err := uuid.Parse(request.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	chirp, err := cfg.Queries.GetChirpIncludingDeleted(request.Context(), chirpID)
+	if err != nil {
+		respondWithError(writer, 404, "chirp not found")
+		return
+	}
+	reports, err := cfg.Queries.ListReportsForChirp(request.Context(), chirp.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving reports")
+		return
+	}
+	history, err := cfg.Queries.ListAuditLog(request.Context(), database.ListAuditLogParams{
+		TargetID:  chirp.ID,
+		RowLimit:  100,
+		RowOffset: 0,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving moderation history")
+		return
+	}
+	type reportJSON struct {
+		Id          uuid.UUID  `json:"id"`
+		Created_at  time.Time  `json:"created_at"`
+		Reporter_id uuid.UUID  `json:"reporter_id"`
+		Reason      string     `json:"reason"`
+		Details     string     `json:"details"`
+		Status      string     `json:"status"`
+		Resolved_at *time.Time `json:"resolved_at"`
+	}
+	type returnjason struct {
+		Chirp     deletedChirpJSON `json:"chirp"`
+		Hidden_at *time.Time       `json:"hidden_at"`
+		Reports   []reportJSON     `json:"reports"`
+		History   []auditLogJSON   `json:"history"`
+	}
+	returning := returnjason{
+		Chirp:   toDeletedChirpJSON(chirp),
+		Reports: []reportJSON{},
+		History: []auditLogJSON{},
+	}
+	if chirp.HiddenAt.Valid {
+		returning.Hidden_at = &chirp.HiddenAt.Time
+	}
+	for _, report := range reports {
+		r := reportJSON{
+			Id:          report.ID,
+			Created_at:  report.CreatedAt,
+			Reporter_id: report.ReporterID,
+			Reason:      report.Reason,
+			Details:     report.Details,
+			Status:      report.Status,
+		}
+		if report.ResolvedAt.Valid {
+			r.Resolved_at = &report.ResolvedAt.Time
+		}
+		returning.Reports = append(returning.Reports, r)
+	}
+	for _, entry := range history {
+		returning.History = append(returning.History, toAuditLogJSON(entry))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+// admin_moderate_chirp resolves the open reports on a chirp. "hide" and
+// "delete" uphold them, "dismiss" rejects them and lifts an automatic hide.
+// A hide a moderator applied stays until "unhide" removes it.
+func (cfg *apiConfig) admin_moderate_chirp(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Action string `json:"action"`
+		Note   string `json:"note"`
+	}
+	actor, ok := cfg.requireRole(writer, request, roleModerator)
+	if !ok {
+		return
+	}
+	chirpID, err := uuid.Parse(request.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	chirp, err := cfg.Queries.GetChirpIncludingDeleted(request.Context(), chirpID)
+	if err != nil {
+		respondWithError(writer, 404, "chirp not found")
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	status := "actioned"
+	switch inc.Action {
+	case "hide":
+		_, err = queries.HideChirp(request.Context(), chirp.ID)
+	case "delete":
+		_, err = queries.SoftDeleteChirp(request.Context(), database.SoftDeleteChirpParams{ID: chirp.ID, DeletedBy: actor})
+	case "dismiss":
+		status = "dismissed"
+		_, err = queries.UnhideAutoHiddenChirp(request.Context(), chirp.ID)
+	case "unhide":
+		status = "dismissed"
+		_, err = queries.UnhideChirp(request.Context(), chirp.ID)
+	default:
+		respondWithError(writer, 400, "action must be hide, delete, dismiss or unhide")
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 500, "error moderating chirp")
+		return
+	}
+	resolved, err := queries.ResolveReports(request.Context(), database.ResolveReportsParams{
+		ChirpID: chirp.ID,
+		Status:  status,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error resolving reports")
+		return
+	}
+	type details struct {
+		Resolved_reports int64  `json:"resolved_reports"`
+		Note             string `json:"note,omitempty"`
+	}
+	err = audit(request.Context(), queries, actor, "chirp."+inc.Action, "chirp", chirp.ID, details{
+		Resolved_reports: resolved,
+		Note:             inc.Note,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error writing audit log")
+		return
+	}
+	if inc.Action == "delete" && !chirp.DeletedAt.Valid {
+		type deletedjson struct {
+			Id      uuid.UUID `json:"id"`
+			User_id uuid.UUID `json:"user_id"`
+		}
+		err = enqueueWebhookEvent(request.Context(), queries, eventChirpDeleted, deletedjson{Id: chirp.ID, User_id: chirp.UserID})
+		if err != nil {
+			respondWithError(writer, 500, "error queueing webhook")
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error committing moderation action")
+		return
+	}
+	chirp, err = cfg.Queries.GetChirpIncludingDeleted(request.Context(), chirp.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving chirp")
+		return
+	}
+	respondWithJSON(writer, 200, toDeletedChirpJSON(chirp))
+}
+
+func (cfg *apiConfig) admin_list_audit_log(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	var targetID uuid.UUID
+	if raw := request.URL.Query().Get("target_id"); raw != "" {
+		var err error
+		targetID, err = uuid.Parse(raw)
+		if err != nil {
+			respondWithError(writer, 400, "invalid target_id")
+			return
+		}
+	}
+	limit, offset := pagination(request)
+	entries, err := cfg.Queries.ListAuditLog(request.Context(), database.ListAuditLogParams{
+		TargetID:  targetID,
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving audit log")
+		return
+	}
+	returning := []auditLogJSON{}
+	for _, entry := range entries {
+		returning = append(returning, toAuditLogJSON(entry))
+	}
+	respondWithJSON(writer, 200, returning)
+}
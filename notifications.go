@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/events"
+	"github.com/Dirza1/Chirpy/internal/handles"
+	"github.com/Dirza1/Chirpy/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+// Internal events published on cfg.Bus. These never leave the process; the
+// outbound webhook events are a separate, public contract.
+const (
+	busChirpPublished = "chirp.published"
+	busUserMentioned  = "user.mentioned"
+	busUserFollowed   = "user.followed"
+)
+
+// notificationTypes maps the bus events that notify someone onto the type
+// stored with the notification.
+var notificationTypes = map[string]string{
+	busUserMentioned: "mention",
+	busUserFollowed:  "follow",
+}
+
+// interaction is the payload of events that notify Recipient about something
+// Actor did, optionally involving a chirp.
+type interaction struct {
+	Recipient uuid.UUID
+	Actor     uuid.UUID
+	ChirpID   uuid.NullUUID
+}
+
+type notificationJSON struct {
+	Id         uuid.UUID  `json:"id"`
+	Created_at time.Time  `json:"created_at"`
+	Type       string     `json:"type"`
+	Actor_id   *uuid.UUID `json:"actor_id"`
+	Chirp_id   *uuid.UUID `json:"chirp_id"`
+	Read_at    *time.Time `json:"read_at"`
+}
+
+func toNotificationJSON(notification database.Notification) notificationJSON {
+	returning := notificationJSON{
+		Id:         notification.ID,
+		Created_at: notification.CreatedAt,
+		Type:       notification.Type,
+	}
+	if notification.ActorID.Valid {
+		returning.Actor_id = &notification.ActorID.UUID
+	}
+	if notification.ChirpID.Valid {
+		returning.Chirp_id = &notification.ChirpID.UUID
+	}
+	if notification.ReadAt.Valid {
+		returning.Read_at = &notification.ReadAt.Time
+	}
+	return returning
+}
+
+// emit publishes an internal event. Failures are logged, the request that
+// caused the event already succeeded.
+func (cfg *apiConfig) emit(ctx context.Context, eventType string, payload interface{}) {
+	err := cfg.Bus.Publish(ctx, events.Event{Type: eventType, Payload: payload})
+	if err != nil {
+		log.Printf("error publishing %s event: %s", eventType, err)
+	}
+}
+
+func (cfg *apiConfig) registerEventHandlers() {
+	cfg.Bus.Subscribe(busChirpPublished, func(ctx context.Context, event events.Event) error {
+		cfg.publishChirp(ctx, event.Payload.(database.Chirp))
+		return nil
+	})
+	cfg.Bus.Subscribe(busChirpPublished, func(ctx context.Context, event events.Event) error {
+		return cfg.notifyMentions(ctx, event.Payload.(database.Chirp))
+	})
+	for eventType := range notificationTypes {
+		cfg.Bus.Subscribe(eventType, cfg.notify)
+	}
+}
+
+// notify stores a notification for an interaction and pushes it to the
+// recipient's open WebSocket connections.
+func (cfg *apiConfig) notify(ctx context.Context, event events.Event) error {
+	payload := event.Payload.(interaction)
+	if payload.Recipient == payload.Actor {
+		return nil
+	}
+	// Nobody hears from users they blocked or muted.
+	filter, err := cfg.chirpFilterFor(ctx, payload.Recipient)
+	if err != nil {
+		return err
+	}
+	if !filter.allows(payload.Actor) {
+		return nil
+	}
+	notification, err := cfg.Queries.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  payload.Recipient,
+		ActorID: uuid.NullUUID{UUID: payload.Actor, Valid: payload.Actor != uuid.Nil},
+		Type:    notificationTypes[event.Type],
+		ChirpID: payload.ChirpID,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(toNotificationJSON(notification))
+	if err != nil {
+		return err
+	}
+	cfg.Hub.Publish(notificationsTopic(payload.Recipient), pubsub.Message{
+		ID:    notification.ID.String(),
+		Event: "notification",
+		Data:  data,
+	})
+	return nil
+}
+
+// notifyMentions notifies the users whose @handle appears in a chirp that
+// just went live. It runs on the bus goroutine, so it calls notify directly
+// instead of publishing again. notify drops mentions of users who blocked
+// or muted the author.
+func (cfg *apiConfig) notifyMentions(ctx context.Context, chirp database.Chirp) error {
+	for _, handle := range handles.Mentions(chirp.Body) {
+		user, err := cfg.Queries.GetUserByHandle(ctx, handle)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = cfg.notify(ctx, events.Event{
+			Type: busUserMentioned,
+			Payload: interaction{
+				Recipient: user.ID,
+				Actor:     chirp.UserID,
+				ChirpID:   uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) list_notifications(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	limit, offset := pagination(request)
+	notifications, err := cfg.Queries.ListNotifications(request.Context(), database.ListNotificationsParams{
+		UserID:     userID,
+		UnreadOnly: request.URL.Query().Get("unread") == "true",
+		RowLimit:   limit,
+		RowOffset:  offset,
+	})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving notifications")
+		return
+	}
+	returning := []notificationJSON{}
+	for _, notification := range notifications {
+		returning = append(returning, toNotificationJSON(notification))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) read_notifications(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		IDs []uuid.UUID `json:"ids"`
+		All bool        `json:"all"`
+	}
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	params := incomming{}
+	err = decoder.Decode(&params)
+	if err != nil || (!params.All && len(params.IDs) == 0) {
+		respondWithError(writer, 400, "ids or all is required")
+		return
+	}
+	var updated int64
+	if params.All {
+		updated, err = cfg.Queries.MarkAllNotificationsRead(request.Context(), userID)
+	} else {
+		updated, err = cfg.Queries.MarkNotificationsRead(request.Context(), database.MarkNotificationsReadParams{
+			UserID:  userID,
+			Column2: params.IDs,
+		})
+	}
+	if err != nil {
+		respondWithError(writer, 500, "error updating notifications")
+		return
+	}
+	type returnjason struct {
+		Updated int64 `json:"updated"`
+	}
+	respondWithJSON(writer, 200, returnjason{Updated: updated})
+}
+
+func (cfg *apiConfig) count_unread_notifications(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	unread, err := cfg.Queries.CountUnreadNotifications(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 500, "error counting notifications")
+		return
+	}
+	type returnjason struct {
+		Unread int64 `json:"unread"`
+	}
+	respondWithJSON(writer, 200, returnjason{Unread: unread})
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const oauthAccessTokenExpiry = 15 * time.Minute
+
+type oauthClientJSON struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func toOAuthClientJSON(client database.OauthClient) oauthClientJSON {
+	return oauthClientJSON{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// validRedirectURI only allows absolute https URIs, or http on the loopback
+// interface for native apps and local development.
+func validRedirectURI(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Fragment != "" || parsed.Host == "" {
+		return false
+	}
+	if parsed.Scheme == "https" {
+		return true
+	}
+	host := parsed.Hostname()
+	return parsed.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+func (cfg *apiConfig) create_oauth_client(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	if strings.TrimSpace(inc.Name) == "" {
+		respondWithError(writer, 400, "name is required")
+		return
+	}
+	if len(inc.RedirectURIs) == 0 {
+		respondWithError(writer, 400, "at least one redirect uri is required")
+		return
+	}
+	for _, uri := range inc.RedirectURIs {
+		if !validRedirectURI(uri) {
+			respondWithError(writer, 400, "invalid redirect uri "+uri)
+			return
+		}
+	}
+	clientID, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(writer, 500, "error generating client id")
+		return
+	}
+	clientID = clientID[:32]
+	secret := ""
+	secretHash := sql.NullString{}
+	if inc.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(writer, 500, "error generating client secret")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+	params := database.CreateOAuthClientParams{
+		ID:           clientID,
+		OwnerID:      userID,
+		Name:         inc.Name,
+		SecretHash:   secretHash,
+		RedirectUris: inc.RedirectURIs,
+	}
+	client, err := cfg.Queries.CreateOAuthClient(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error creating client")
+		return
+	}
+	returning := toOAuthClientJSON(client)
+	// the secret is only ever shown once
+	returning.ClientSecret = secret
+	respondWithJSON(writer, 201, returning)
+}
+
+func (cfg *apiConfig) list_oauth_clients(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	clients, err := cfg.Queries.ListOAuthClientsForOwner(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving clients")
+		return
+	}
+	returning := []oauthClientJSON{}
+	for _, client := range clients {
+		returning = append(returning, toOAuthClientJSON(client))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) delete_oauth_client(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	params := database.DeleteOAuthClientParams{
+		ID:      request.PathValue("clientID"),
+		OwnerID: userID,
+	}
+	deleted, err := cfg.Queries.DeleteOAuthClient(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error deleting client")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(writer, 404, "client not found")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
+
+type authorizeRequest struct {
+	client              database.OauthClient
+	redirectURI         string
+	scopes              []string
+	state               string
+	codeChallenge       string
+	codeChallengeMethod string
+}
+
+// parseAuthorizeRequest validates the parameters shared by both authorize
+// endpoints. Errors before the redirect uri is known must never redirect.
+func (cfg *apiConfig) parseAuthorizeRequest(request *http.Request) (authorizeRequest, error) {
+	authReq := authorizeRequest{}
+	if request.FormValue("response_type") != "code" {
+		return authReq, errors.New("response_type must be code")
+	}
+	client, err := cfg.Queries.GetOAuthClient(request.Context(), request.FormValue("client_id"))
+	if err != nil {
+		return authReq, errors.New("unknown client")
+	}
+	redirectURI := request.FormValue("redirect_uri")
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return authReq, errors.New("redirect_uri is not registered for this client")
+	}
+	scopes, err := auth.ParseScopes(request.FormValue("scope"))
+	if err != nil {
+		return authReq, err
+	}
+	if request.FormValue("code_challenge_method") != "S256" || request.FormValue("code_challenge") == "" {
+		return authReq, errors.New("PKCE with code_challenge_method S256 is required")
+	}
+	authReq = authorizeRequest{
+		client:              client,
+		redirectURI:         redirectURI,
+		scopes:              scopes,
+		state:               request.FormValue("state"),
+		codeChallenge:       request.FormValue("code_challenge"),
+		codeChallengeMethod: request.FormValue("code_challenge_method"),
+	}
+	return authReq, nil
+}
+
+// oauth_authorize_info describes a pending authorization request so the
+// frontend can render the consent screen.
+func (cfg *apiConfig) oauth_authorize_info(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	authReq, err := cfg.parseAuthorizeRequest(request)
+	if err != nil {
+		respondWithError(writer, 400, err.Error())
+		return
+	}
+	previouslyGranted := false
+	consent, err := cfg.Queries.GetOAuthConsent(request.Context(), database.GetOAuthConsentParams{UserID: userID, ClientID: authReq.client.ID})
+	if err == nil {
+		granted := strings.Fields(consent.Scopes)
+		previouslyGranted = true
+		for _, scope := range authReq.scopes {
+			if !slices.Contains(granted, scope) {
+				previouslyGranted = false
+			}
+		}
+	}
+	type returnjason struct {
+		ClientID          string   `json:"client_id"`
+		ClientName        string   `json:"client_name"`
+		RedirectURI       string   `json:"redirect_uri"`
+		Scopes            []string `json:"scopes"`
+		PreviouslyGranted bool     `json:"previously_granted"`
+	}
+	returning := returnjason{
+		ClientID:          authReq.client.ID,
+		ClientName:        authReq.client.Name,
+		RedirectURI:       authReq.redirectURI,
+		Scopes:            authReq.scopes,
+		PreviouslyGranted: previouslyGranted,
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+// oauth_authorize records the user's decision on the consent screen and
+// redirects back to the client with either a code or an error.
+func (cfg *apiConfig) oauth_authorize(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	authReq, err := cfg.parseAuthorizeRequest(request)
+	if err != nil {
+		respondWithError(writer, 400, err.Error())
+		return
+	}
+	redirect, _ := url.Parse(authReq.redirectURI)
+	query := redirect.Query()
+	if authReq.state != "" {
+		query.Set("state", authReq.state)
+	}
+	if request.FormValue("approve") != "true" {
+		query.Set("error", "access_denied")
+		redirect.RawQuery = query.Encode()
+		http.Redirect(writer, request, redirect.String(), http.StatusFound)
+		return
+	}
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(writer, 500, "error generating authorization code")
+		return
+	}
+	scope := strings.Join(authReq.scopes, " ")
+	consentParams := database.UpsertOAuthConsentParams{
+		UserID:   userID,
+		ClientID: authReq.client.ID,
+		Scopes:   scope,
+	}
+	err = cfg.Queries.UpsertOAuthConsent(request.Context(), consentParams)
+	if err != nil {
+		respondWithError(writer, 500, "error storing consent")
+		return
+	}
+	codeParams := database.CreateAuthorizationCodeParams{
+		CodeHash:            auth.HashToken(code),
+		ClientID:            authReq.client.ID,
+		UserID:              userID,
+		RedirectUri:         authReq.redirectURI,
+		Scopes:              scope,
+		CodeChallenge:       authReq.codeChallenge,
+		CodeChallengeMethod: authReq.codeChallengeMethod,
+	}
+	err = cfg.Queries.CreateAuthorizationCode(request.Context(), codeParams)
+	if err != nil {
+		respondWithError(writer, 500, "error storing authorization code")
+		return
+	}
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+	http.Redirect(writer, request, redirect.String(), http.StatusFound)
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, oauthErr, description string) {
+	type returnjason struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	respondWithJSON(w, code, returnjason{Error: oauthErr, ErrorDescription: description})
+}
+
+// authenticateClient checks the client credentials of a token or revoke
+// request. Public clients only need to send their client_id.
+func (cfg *apiConfig) authenticateClient(request *http.Request) (database.OauthClient, error) {
+	clientID, clientSecret, ok := request.BasicAuth()
+	if !ok {
+		clientID = request.FormValue("client_id")
+		clientSecret = request.FormValue("client_secret")
+	}
+	client, err := cfg.Queries.GetOAuthClient(request.Context(), clientID)
+	if err != nil {
+		return client, errors.New("unknown client")
+	}
+	if client.SecretHash.Valid {
+		if subtle.ConstantTimeCompare([]byte(auth.HashToken(clientSecret)), []byte(client.SecretHash.String)) != 1 {
+			return client, errors.New("invalid client credentials")
+		}
+	}
+	return client, nil
+}
+
+func (cfg *apiConfig) oauth_token(writer http.ResponseWriter, request *http.Request) {
+	client, err := cfg.authenticateClient(request)
+	if err != nil {
+		respondWithOAuthError(writer, 401, "invalid_client", err.Error())
+		return
+	}
+	// Consuming the grant and storing the new refresh token happen together,
+	// so a failed insert never costs the client its code or refresh token.
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithOAuthError(writer, 500, "server_error", "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	var userID uuid.UUID
+	var scopes []string
+	switch request.FormValue("grant_type") {
+	case "authorization_code":
+		codeHash := auth.HashToken(request.FormValue("code"))
+		code, err := queries.UseAuthorizationCode(request.Context(), codeHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.revokeReplayedCode(request.Context(), codeHash, client.ID)
+		}
+		if err != nil || code.ClientID != client.ID || code.RedirectUri != request.FormValue("redirect_uri") {
+			respondWithOAuthError(writer, 400, "invalid_grant", "invalid, expired or already used authorization code")
+			return
+		}
+		if !auth.VerifyPKCE(request.FormValue("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod) {
+			respondWithOAuthError(writer, 400, "invalid_grant", "code_verifier does not match code_challenge")
+			return
+		}
+		userID = code.UserID
+		scopes = strings.Fields(code.Scopes)
+	case "refresh_token":
+		old, err := queries.GetUserFromRefreshToken(request.Context(), request.FormValue("refresh_token"))
+		if err != nil || old.ClientID.String != client.ID || old.RevokedAt.Valid || old.ExpiresAt.Before(time.Now()) {
+			respondWithOAuthError(writer, 400, "invalid_grant", "invalid or expired refresh token")
+			return
+		}
+		// refresh tokens rotate on every use; a token another request
+		// already rotated is rejected like any other revoked token
+		revoked, err := queries.RevokeActiveRefreshToken(request.Context(), old.Token)
+		if err != nil {
+			respondWithOAuthError(writer, 500, "server_error", "error rotating refresh token")
+			return
+		}
+		if revoked != 1 {
+			respondWithOAuthError(writer, 400, "invalid_grant", "invalid or expired refresh token")
+			return
+		}
+		userID = old.UserID
+		scopes = strings.Fields(old.Scopes.String)
+	default:
+		respondWithOAuthError(writer, 400, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+	suspension, err := queries.GetAccountStatus(request.Context(), userID)
+	if err != nil || suspension.SuspendedAt.Valid {
+		respondWithOAuthError(writer, 400, "invalid_grant", "the account has been suspended")
+		return
+	}
+	accessToken, err := auth.MakeOAuthAccessToken(userID, client.ID, scopes, cfg.SecretToken, oauthAccessTokenExpiry)
+	if err != nil {
+		respondWithOAuthError(writer, 500, "server_error", "error during token generation")
+		return
+	}
+	randomToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithOAuthError(writer, 500, "server_error", "error during token generation")
+		return
+	}
+	scope := strings.Join(scopes, " ")
+	refreshParams := database.CreateOAuthRefreshTokenParams{
+		Token:    randomToken,
+		UserID:   userID,
+		ClientID: sql.NullString{String: client.ID, Valid: true},
+		Scopes:   sql.NullString{String: scope, Valid: true},
+	}
+	refreshToken, err := queries.CreateOAuthRefreshToken(request.Context(), refreshParams)
+	if err != nil {
+		respondWithOAuthError(writer, 500, "server_error", "error storing refresh token")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithOAuthError(writer, 500, "server_error", "error storing refresh token")
+		return
+	}
+	type returnjason struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	returning := returnjason{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenExpiry.Seconds()),
+		RefreshToken: refreshToken.Token,
+		Scope:        scope,
+	}
+	writer.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(writer, 200, returning)
+}
+
+// revokeReplayedCode handles an authorization code presented a second time.
+// Per RFC 6749 section 4.1.2 the tokens issued from it are revoked; they are
+// not linked to the code, so every refresh token the client holds for that
+// user goes. Access tokens expire on their own.
+func (cfg *apiConfig) revokeReplayedCode(ctx context.Context, codeHash, clientID string) {
+	code, err := cfg.Queries.GetUsedAuthorizationCode(ctx, codeHash)
+	if err != nil || code.ClientID != clientID {
+		return
+	}
+	err = cfg.Queries.RevokeClientRefreshTokensForUser(ctx, database.RevokeClientRefreshTokensForUserParams{
+		UserID:   code.UserID,
+		ClientID: sql.NullString{String: clientID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("error revoking tokens of replayed authorization code: %s", err)
+	}
+}
+
+// oauth_revoke implements RFC 7009 for refresh tokens. Unknown tokens are
+// not an error.
+func (cfg *apiConfig) oauth_revoke(writer http.ResponseWriter, request *http.Request) {
+	client, err := cfg.authenticateClient(request)
+	if err != nil {
+		respondWithOAuthError(writer, 401, "invalid_client", err.Error())
+		return
+	}
+	token, err := cfg.Queries.GetUserFromRefreshToken(request.Context(), request.FormValue("token"))
+	if err == nil && token.ClientID.String == client.ID {
+		err = cfg.Queries.RevokeRefreshToken(request.Context(), token.Token)
+		if err != nil {
+			respondWithOAuthError(writer, 500, "server_error", "error revoking token")
+			return
+		}
+	}
+	writer.WriteHeader(200)
+}
+
+func (cfg *apiConfig) list_oauth_authorizations(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	consents, err := cfg.Queries.ListOAuthConsentsForUser(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving authorizations")
+		return
+	}
+	type returnjason struct {
+		ClientID   string    `json:"client_id"`
+		ClientName string    `json:"client_name"`
+		Scopes     []string  `json:"scopes"`
+		GrantedAt  time.Time `json:"granted_at"`
+	}
+	returning := []returnjason{}
+	for _, consent := range consents {
+		returning = append(returning, returnjason{
+			ClientID:   consent.ClientID,
+			ClientName: consent.Name,
+			Scopes:     strings.Fields(consent.Scopes),
+			GrantedAt:  consent.CreatedAt,
+		})
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+// revoke_oauth_authorization removes a client's access to the user's account
+// and revokes every refresh token issued to it. Outstanding access tokens
+// stay valid until they expire.
+func (cfg *apiConfig) revoke_oauth_authorization(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	clientID := request.PathValue("clientID")
+	deleted, err := cfg.Queries.DeleteOAuthConsent(request.Context(), database.DeleteOAuthConsentParams{UserID: userID, ClientID: clientID})
+	if err != nil {
+		respondWithError(writer, 500, "error revoking authorization")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(writer, 404, "authorization not found")
+		return
+	}
+	params := database.RevokeClientRefreshTokensForUserParams{
+		UserID:   userID,
+		ClientID: sql.NullString{String: clientID, Valid: true},
+	}
+	err = cfg.Queries.RevokeClientRefreshTokensForUser(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error revoking tokens")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Events downstream services can subscribe to.
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserCreated  = "user.created"
+	eventUserUpgraded = "user.upgraded"
+)
+
+var outboundEvents = []string{eventChirpCreated, eventChirpDeleted, eventUserCreated, eventUserUpgraded}
+
+const (
+	outboundMaxAttempts  = 8
+	outboundBaseBackoff  = 30 * time.Second
+	outboundMaxBackoff   = 6 * time.Hour
+	outboundBatchSize    = 20
+	outboundPollInterval = 5 * time.Second
+)
+
+var outboundClient = &http.Client{Timeout: 10 * time.Second}
+
+// enqueueWebhookEvent queues event for every subscription listening to it.
+// Pass the transaction's queries so the event is only queued when the change
+// that caused it commits.
+func enqueueWebhookEvent(ctx context.Context, queries *database.Queries, event string, data interface{}) error {
+	type envelope struct {
+		ID        uuid.UUID   `json:"id"`
+		Event     string      `json:"event"`
+		CreatedAt time.Time   `json:"created_at"`
+		Data      interface{} `json:"data"`
+	}
+	payload, err := json.Marshal(envelope{
+		ID:        uuid.New(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = queries.EnqueueOutboundDeliveries(ctx, database.EnqueueOutboundDeliveriesParams{
+		Event:   event,
+		Payload: payload,
+	})
+	return err
+}
+
+// deliverWebhooks sends every due delivery once. Failed deliveries are
+// retried with exponential backoff until they end up in the dead letter view.
+func (cfg *apiConfig) deliverWebhooks(ctx context.Context) error {
+	deliveries, err := cfg.Queries.ClaimDueDeliveries(ctx, outboundBatchSize)
+	if err != nil {
+		return err
+	}
+	// The claim is a two minute lease. Sending the batch concurrently keeps it
+	// to one client timeout, so no row is re-claimed while still in flight.
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg.attemptDelivery(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (cfg *apiConfig) attemptDelivery(ctx context.Context, delivery database.OutboundDelivery) {
+	subscription, err := cfg.Queries.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		log.Printf("error loading webhook subscription %s: %s", delivery.SubscriptionID, err)
+		return
+	}
+	statusCode, err := sendWebhook(ctx, subscription, delivery)
+	code := sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0}
+	if err == nil {
+		err = cfg.Queries.MarkDeliverySucceeded(ctx, database.MarkDeliverySucceededParams{ID: delivery.ID, LastStatusCode: code})
+		if err != nil {
+			log.Printf("error marking webhook delivery %s as delivered: %s", delivery.ID, err)
+		}
+		return
+	}
+	attempts := int(delivery.Attempts) + 1
+	status := "pending"
+	if attempts >= outboundMaxAttempts {
+		status = "dead"
+	}
+	backoff := outboundBaseBackoff << (attempts - 1)
+	if backoff > outboundMaxBackoff {
+		backoff = outboundMaxBackoff
+	}
+	params := database.MarkDeliveryFailedParams{
+		ID:             delivery.ID,
+		Status:         status,
+		BackoffSeconds: backoff.Seconds(),
+		LastStatusCode: code,
+		LastError:      sql.NullString{String: err.Error(), Valid: true},
+	}
+	err = cfg.Queries.MarkDeliveryFailed(ctx, params)
+	if err != nil {
+		log.Printf("error recording failed webhook delivery %s: %s", delivery.ID, err)
+	}
+}
+
+// sendWebhook POSTs the payload signed the same way Polka signs its
+// deliveries to us: X-Chirpy-Signature is v1=HMAC-SHA256("<timestamp>.<body>").
+func sendWebhook(ctx context.Context, subscription database.WebhookSubscription, delivery database.OutboundDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequestWithContext(ctx, "POST", subscription.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	request.Header.Set("X-Chirpy-Event", delivery.Event)
+	request.Header.Set("X-Chirpy-Delivery", delivery.ID.String())
+	request.Header.Set("X-Chirpy-Timestamp", timestamp)
+	request.Header.Set("X-Chirpy-Signature", "v1="+auth.SignWebhook(subscription.Secret, timestamp, delivery.Payload))
+	response, err := outboundClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("endpoint responded with %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+type webhookSubscriptionJSON struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toWebhookSubscriptionJSON(subscription database.WebhookSubscription) webhookSubscriptionJSON {
+	return webhookSubscriptionJSON{
+		ID:        subscription.ID,
+		URL:       subscription.Url,
+		Events:    subscription.Events,
+		Active:    subscription.Active,
+		CreatedAt: subscription.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) admin_create_webhook_subscription(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	parsed, err := url.Parse(inc.URL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		respondWithError(writer, 400, "url must be an absolute http(s) url")
+		return
+	}
+	if len(inc.Events) == 0 {
+		respondWithError(writer, 400, "at least one event is required")
+		return
+	}
+	for _, event := range inc.Events {
+		if !slices.Contains(outboundEvents, event) {
+			respondWithError(writer, 400, "unknown event "+event)
+			return
+		}
+	}
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(writer, 500, "error generating secret")
+		return
+	}
+	params := database.CreateWebhookSubscriptionParams{
+		Url:    inc.URL,
+		Secret: secret,
+		Events: inc.Events,
+	}
+	subscription, err := cfg.Queries.CreateWebhookSubscription(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error creating subscription")
+		return
+	}
+	returning := toWebhookSubscriptionJSON(subscription)
+	// the signing secret is only ever shown once
+	returning.Secret = secret
+	respondWithJSON(writer, 201, returning)
+}
+
+func (cfg *apiConfig) admin_list_webhook_subscriptions(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	subscriptions, err := cfg.Queries.ListWebhookSubscriptions(request.Context())
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving subscriptions")
+		return
+	}
+	returning := []webhookSubscriptionJSON{}
+	for _, subscription := range subscriptions {
+		returning = append(returning, toWebhookSubscriptionJSON(subscription))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) admin_delete_webhook_subscription(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	id, err := uuid.Parse(request.PathValue("subscriptionID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	deleted, err := cfg.Queries.DeleteWebhookSubscription(request.Context(), id)
+	if err != nil {
+		respondWithError(writer, 500, "error deleting subscription")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(writer, 404, "subscription not found")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
+
+func (cfg *apiConfig) admin_list_dead_deliveries(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	limit, offset := pagination(request)
+	deliveries, err := cfg.Queries.ListDeadDeliveries(request.Context(), database.ListDeadDeliveriesParams{Limit: limit, Offset: offset})
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving deliveries")
+		return
+	}
+	type returnjason struct {
+		ID             uuid.UUID       `json:"id"`
+		SubscriptionID uuid.UUID       `json:"subscription_id"`
+		Event          string          `json:"event"`
+		Payload        json.RawMessage `json:"payload"`
+		Attempts       int32           `json:"attempts"`
+		LastStatusCode *int32          `json:"last_status_code"`
+		LastError      string          `json:"last_error"`
+		CreatedAt      time.Time       `json:"created_at"`
+	}
+	returning := []returnjason{}
+	for _, delivery := range deliveries {
+		item := returnjason{
+			ID:             delivery.ID,
+			SubscriptionID: delivery.SubscriptionID,
+			Event:          delivery.Event,
+			Payload:        delivery.Payload,
+			Attempts:       delivery.Attempts,
+			LastError:      delivery.LastError.String,
+			CreatedAt:      delivery.CreatedAt,
+		}
+		if delivery.LastStatusCode.Valid {
+			item.LastStatusCode = &delivery.LastStatusCode.Int32
+		}
+		returning = append(returning, item)
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) admin_retry_dead_delivery(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	id, err := uuid.Parse(request.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	retried, err := cfg.Queries.RetryDeadDelivery(request.Context(), id)
+	if err != nil {
+		respondWithError(writer, 500, "error requeueing delivery")
+		return
+	}
+	if retried == 0 {
+		respondWithError(writer, 404, "dead delivery not found")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
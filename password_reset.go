@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/mailer"
+)
+
+func (cfg *apiConfig) request_password_reset(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	if wait, ok := cfg.ResetIPLimiter.Allow(clientIP(request)); !ok {
+		respondTooManyRequests(writer, wait)
+		return
+	}
+	type returnjason struct {
+		Message string `json:"message"`
+	}
+	// the response never reveals whether the email belongs to an account
+	accepted := returnjason{
+		Message: "if the address belongs to an account, a reset email has been sent",
+	}
+	if _, ok := cfg.ResetAccountLimiter.Allow(strings.ToLower(inc.Email)); !ok {
+		respondWithJSON(writer, 202, accepted)
+		return
+	}
+	user, err := cfg.Queries.ReturnUserByEmail(request.Context(), inc.Email)
+	if err == nil {
+		// Off the request path, so known and unknown addresses take the same
+		// time to answer.
+		go cfg.sendPasswordReset(context.Background(), user)
+	}
+	respondWithJSON(writer, 202, accepted)
+}
+
+// sendPasswordReset stores a new reset token for user and mails it. Errors
+// are only logged: the request was answered before this runs.
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, user database.User) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("error generating password reset token for %s: %s", user.ID, err)
+		return
+	}
+	params := database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+	}
+	_, err = cfg.Queries.CreatePasswordResetToken(ctx, params)
+	if err != nil {
+		log.Printf("error storing password reset token for %s: %s", user.ID, err)
+		return
+	}
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\nSend this token to POST /api/password-reset/confirm together with your new password:\n\n%s\n\nThe token expires in one hour. If this wasn't you, you can ignore this email.",
+			token),
+	}
+	err = cfg.Mailer.Send(ctx, msg)
+	if err != nil {
+		log.Printf("error sending password reset email to %s: %s", user.Email, err)
+	}
+}
+
+func (cfg *apiConfig) confirm_password_reset(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	if wait, ok := cfg.ResetIPLimiter.Allow(clientIP(request)); !ok {
+		respondTooManyRequests(writer, wait)
+		return
+	}
+	err = cfg.PasswordPolicy.Validate(inc.Password)
+	if err != nil {
+		respondWithError(writer, 400, err.Error())
+		return
+	}
+	hashedPassword, err := cfg.Hasher.Hash(inc.Password)
+	if err != nil {
+		respondWithError(writer, 500, "Something went wrong during password hash")
+		return
+	}
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	resetToken, err := queries.UsePasswordResetToken(request.Context(), auth.HashToken(inc.Token))
+	if err != nil {
+		respondWithError(writer, 400, "invalid or expired reset token")
+		return
+	}
+	params := database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             resetToken.UserID,
+	}
+	err = queries.UpdateUserPassword(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error updating password")
+		return
+	}
+	// The reset token was mailed to the account's address, so using it
+	// proves the user owns that inbox.
+	err = queries.MarkEmailVerified(request.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "error updating password")
+		return
+	}
+	err = queries.InvalidatePasswordResetTokens(request.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "error invalidating reset tokens")
+		return
+	}
+	err = queries.RevokeAllRefreshTokensForUser(request.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(writer, 500, "error revoking sessions")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error committing password reset")
+		return
+	}
+	respondWithJSON(writer, 204, nil)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	polkaReplayWindow   = 5 * time.Minute
+	defaultPolkaPeriod  = 30 * 24 * time.Hour
+	polkaEventUpgraded  = "user.upgraded"
+	polkaEventDowngrade = "user.downgraded"
+	polkaEventRenewed   = "subscription.renewed"
+	polkaEventCancelled = "subscription.cancelled"
+)
+
+func (cfg *apiConfig) polka_webhooks(writer http.ResponseWriter, request *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, 1<<20))
+	if err != nil {
+		respondWithError(writer, 400, "error reading the request body")
+		return
+	}
+	err = cfg.verifyPolkaRequest(request, body)
+	if err != nil {
+		result := webhookResult{outcome: webhookRejected, statusCode: 401, err: err}
+		// Anyone can reach this endpoint, so only a few rejections per IP
+		// make it into the log.
+		if _, ok := cfg.RejectedWebhookLimiter.Allow(clientIP(request)); ok {
+			cfg.logWebhookDelivery(request.Context(), "polka", request.Header, body, result, uuid.NullUUID{})
+		}
+		respondWithWebhookResult(writer, result)
+		return
+	}
+	result := cfg.processPolkaEvent(request.Context(), body)
+	cfg.logWebhookDelivery(request.Context(), "polka", request.Header, body, result, uuid.NullUUID{})
+	respondWithWebhookResult(writer, result)
+}
+
+// processPolkaEvent applies a verified Polka delivery. It is shared by the
+// webhook endpoint and the admin replay tool.
+func (cfg *apiConfig) processPolkaEvent(ctx context.Context, body []byte) webhookResult {
+	type datajson struct {
+		UserId      uuid.UUID  `json:"user_id"`
+		PeriodStart *time.Time `json:"period_start"`
+		PeriodEnd   *time.Time `json:"period_end"`
+	}
+	type incomming struct {
+		ID    string   `json:"id"`
+		Event string   `json:"event"`
+		Data  datajson `json:"data"`
+	}
+	inc := incomming{}
+	err := json.Unmarshal(body, &inc)
+	if err != nil {
+		return webhookResult{outcome: webhookInvalid, statusCode: 404, err: errors.New("error decoding the incomming json")}
+	}
+	result := webhookResult{eventID: inc.ID, event: inc.Event}
+	fail := func(outcome string, code int, msg string) webhookResult {
+		result.outcome = outcome
+		result.statusCode = code
+		result.err = errors.New(msg)
+		return result
+	}
+	if inc.ID == "" {
+		return fail(webhookInvalid, 400, "missing event id")
+	}
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(webhookFailed, 500, "error starting transaction")
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	eventParams := database.RecordWebhookEventParams{
+		ID:     inc.ID,
+		Source: "polka",
+		Event:  inc.Event,
+	}
+	recorded, err := queries.RecordWebhookEvent(ctx, eventParams)
+	if err != nil {
+		return fail(webhookFailed, 500, "error recording event")
+	}
+	if recorded == 0 {
+		// already processed, Polka is retrying a delivery we acknowledged
+		result.outcome = webhookDuplicate
+		result.statusCode = 204
+		return result
+	}
+	periodStart := time.Now().UTC()
+	if inc.Data.PeriodStart != nil {
+		periodStart = *inc.Data.PeriodStart
+	}
+	periodEnd := periodStart.Add(defaultPolkaPeriod)
+	if inc.Data.PeriodEnd != nil {
+		periodEnd = *inc.Data.PeriodEnd
+	}
+	userID := inc.Data.UserId
+	result.outcome = webhookProcessed
+	switch inc.Event {
+	case polkaEventUpgraded:
+		_, err = queries.StartSubscription(ctx, database.StartSubscriptionParams{
+			UserID:             userID,
+			CurrentPeriodStart: periodStart,
+			CurrentPeriodEnd:   periodEnd,
+		})
+		if err == nil {
+			type upgradedjson struct {
+				User_id    uuid.UUID `json:"user_id"`
+				Period_end time.Time `json:"period_end"`
+			}
+			err = enqueueWebhookEvent(ctx, queries, eventUserUpgraded, upgradedjson{User_id: userID, Period_end: periodEnd})
+		}
+	case polkaEventRenewed:
+		var renewed int64
+		renewed, err = queries.RenewSubscription(ctx, database.RenewSubscriptionParams{
+			UserID:             userID,
+			CurrentPeriodStart: periodStart,
+			CurrentPeriodEnd:   periodEnd,
+		})
+		if err == nil && renewed == 0 {
+			_, err = queries.StartSubscription(ctx, database.StartSubscriptionParams{
+				UserID:             userID,
+				CurrentPeriodStart: periodStart,
+				CurrentPeriodEnd:   periodEnd,
+			})
+		}
+	case polkaEventCancelled:
+		// cancelled subscriptions keep Chirpy Red until the paid period ends
+		_, err = queries.CancelSubscription(ctx, userID)
+	case polkaEventDowngrade:
+		_, err = queries.EndSubscription(ctx, userID)
+	default:
+		// unknown events are recorded and acknowledged so Polka stops retrying
+		result.outcome = webhookIgnored
+	}
+	if err != nil {
+		return fail(webhookFailed, 404, "error updating subscription")
+	}
+	if result.outcome == webhookProcessed {
+		err = queries.SyncChirpyRed(ctx, userID)
+		if err != nil {
+			return fail(webhookFailed, 500, "error updating user")
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fail(webhookFailed, 500, "error recording event")
+	}
+	result.statusCode = 204
+	return result
+}
+
+// verifyPolkaRequest checks the HMAC signature of a Polka delivery. The
+// static ApiKey header is only accepted when the legacy mode was explicitly
+// enabled at startup.
+func (cfg *apiConfig) verifyPolkaRequest(request *http.Request, body []byte) error {
+	if len(cfg.PolkaSecrets) > 0 {
+		return auth.VerifyWebhookSignature(body,
+			request.Header.Get("X-Polka-Timestamp"),
+			request.Header.Get("X-Polka-Signature"),
+			cfg.PolkaSecrets, time.Now(), polkaReplayWindow)
+	}
+	if !cfg.PolkaLegacyKey {
+		return errors.New("no webhook signing secret configured")
+	}
+	recievedApiKey, err := auth.GetAPIKey(request.Header)
+	if err != nil {
+		return errors.New("error retrieving the key")
+	}
+	if cfg.PolkaKKey == "" || subtle.ConstantTimeCompare([]byte(recievedApiKey), []byte(cfg.PolkaKKey)) != 1 {
+		return errors.New("incorrect API key")
+	}
+	return nil
+}
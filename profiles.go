@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/media"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 280
+)
+
+// profileJSON is what anyone may see about a user. It must never carry the
+// email address or anything else private.
+type profileJSON struct {
+	Id            uuid.UUID `json:"id"`
+	Created_at    time.Time `json:"created_at"`
+	Handle        *string   `json:"handle"`
+	Display_name  string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	Avatar_url    *string   `json:"avatar_url"`
+	Is_chirpy_red bool      `json:"is_chirpy_red"`
+}
+
+// authorJSON is the short form of a profile embedded in chirp responses.
+type authorJSON struct {
+	Id           uuid.UUID `json:"id"`
+	Handle       *string   `json:"handle"`
+	Display_name string    `json:"display_name"`
+	Avatar_url   *string   `json:"avatar_url"`
+}
+
+func (cfg *apiConfig) avatarURL(user database.User) *string {
+	if !user.AvatarKey.Valid {
+		return nil
+	}
+	url := cfg.Storage.URL(user.AvatarKey.String)
+	return &url
+}
+
+func nullableString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
+
+func (cfg *apiConfig) toProfileJSON(user database.User) profileJSON {
+	return profileJSON{
+		Id:            user.ID,
+		Created_at:    user.CreatedAt,
+		Handle:        nullableString(user.Handle),
+		Display_name:  user.DisplayName,
+		Bio:           user.Bio,
+		Avatar_url:    cfg.avatarURL(user),
+		Is_chirpy_red: user.IsChirpyRed,
+	}
+}
+
+func (cfg *apiConfig) toAuthorJSON(user database.User) authorJSON {
+	return authorJSON{
+		Id:           user.ID,
+		Handle:       nullableString(user.Handle),
+		Display_name: user.DisplayName,
+		Avatar_url:   cfg.avatarURL(user),
+	}
+}
+
+// authorsForChirps loads the author of every chirp with a single query.
+func (cfg *apiConfig) authorsForChirps(ctx context.Context, chirps []database.Chirp) (map[uuid.UUID]authorJSON, error) {
+	authors := map[uuid.UUID]authorJSON{}
+	ids := []uuid.UUID{}
+	for _, chirp := range chirps {
+		if _, ok := authors[chirp.UserID]; ok {
+			continue
+		}
+		authors[chirp.UserID] = authorJSON{Id: chirp.UserID}
+		ids = append(ids, chirp.UserID)
+	}
+	if len(ids) == 0 {
+		return authors, nil
+	}
+	users, err := cfg.Queries.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		authors[user.ID] = cfg.toAuthorJSON(user)
+	}
+	return authors, nil
+}
+
+func (cfg *apiConfig) get_user(writer http.ResponseWriter, request *http.Request) {
+	id, err := uuid.Parse(request.PathValue("userID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), id)
+	if err != nil || user.DeletionRequestedAt.Valid {
+		respondWithError(writer, 404, "user not found")
+		return
+	}
+	respondWithJSON(writer, 200, cfg.toProfileJSON(user))
+}
+
+func (cfg *apiConfig) get_user_by_handle(writer http.ResponseWriter, request *http.Request) {
+	handle := request.PathValue("handle")
+	user, err := cfg.Queries.GetUserByHandle(request.Context(), handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.redirectOldHandle(writer, request, handle)
+		return
+	}
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving user")
+		return
+	}
+	if user.DeletionRequestedAt.Valid {
+		respondWithError(writer, 404, "user not found")
+		return
+	}
+	respondWithJSON(writer, 200, cfg.toProfileJSON(user))
+}
+
+func (cfg *apiConfig) update_profile(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Display_name *string `json:"display_name"`
+		Bio          *string `json:"bio"`
+	}
+	userID, err := cfg.authenticate(request, auth.ScopeProfile)
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 401, "unknown user")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "something went wrong")
+		return
+	}
+	params := database.UpdateUserProfileParams{
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		ID:          user.ID,
+	}
+	if inc.Display_name != nil {
+		params.DisplayName = strings.TrimSpace(*inc.Display_name)
+		if len([]rune(params.DisplayName)) > maxDisplayNameLength {
+			respondWithError(writer, 400, "display name too long")
+			return
+		}
+	}
+	if inc.Bio != nil {
+		params.Bio = strings.TrimSpace(*inc.Bio)
+		if len([]rune(params.Bio)) > maxBioLength {
+			respondWithError(writer, 400, "bio too long")
+			return
+		}
+	}
+	user, err = cfg.Queries.UpdateUserProfile(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error updating profile")
+		return
+	}
+	respondWithJSON(writer, 200, cfg.toProfileJSON(user))
+}
+
+// upload_avatar replaces the caller's avatar with the image in the avatar
+// field of a multipart form. Avatars are stored at thumbnail size.
+func (cfg *apiConfig) upload_avatar(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, auth.ScopeProfile)
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 401, "unknown user")
+		return
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, media.MaxImageBytes+1<<20)
+	file, _, err := request.FormFile("avatar")
+	if err != nil {
+		respondWithError(writer, 400, "avatar file is required")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(writer, 413, "avatar too large")
+		return
+	}
+	img, err := media.Process(data)
+	switch {
+	case errors.Is(err, media.ErrUnsupportedType):
+		respondWithError(writer, 415, "avatar must be a JPEG, PNG, GIF or WebP image")
+		return
+	case errors.Is(err, media.ErrTooLarge):
+		respondWithError(writer, 413, "avatar too large")
+		return
+	case err != nil:
+		respondWithError(writer, 400, "invalid avatar")
+		return
+	}
+	key := "avatar_" + uuid.NewString() + "." + img.ThumbnailExt
+	err = cfg.Storage.Put(request.Context(), key, img.ThumbnailType, img.Thumbnail)
+	if err != nil {
+		respondWithError(writer, 500, "error storing avatar")
+		return
+	}
+	err = cfg.Queries.SetUserAvatar(request.Context(), database.SetUserAvatarParams{
+		AvatarKey: sql.NullString{String: key, Valid: true},
+		ID:        user.ID,
+	})
+	if err != nil {
+		cfg.Storage.Delete(request.Context(), key)
+		respondWithError(writer, 500, "error storing avatar")
+		return
+	}
+	if user.AvatarKey.Valid {
+		cfg.Storage.Delete(request.Context(), user.AvatarKey.String)
+	}
+	user.AvatarKey = sql.NullString{String: key, Valid: true}
+	respondWithJSON(writer, 200, cfg.toProfileJSON(user))
+}
@@ -0,0 +1,68 @@
+-- name: RequestAccountDeletion :exec
+UPDATE users
+SET deletion_requested_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: CancelAccountDeletion :exec
+UPDATE users
+SET deletion_requested_at = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListUsersDueForPurge :many
+SELECT id, avatar_key FROM users
+WHERE deletion_requested_at <= NOW() - make_interval(secs => sqlc.arg(grace_seconds)::float8);
+
+-- name: ListMediaKeysForUser :many
+SELECT media_attachments.storage_key, media_attachments.thumbnail_key
+FROM media_attachments
+JOIN chirps ON chirps.id = media_attachments.chirp_id
+WHERE chirps.user_id = $1;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: RevokeAllAPIKeysForUser :exec
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListChirpsForUser :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListRefreshTokensForUser :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListNotificationsForUser :many
+SELECT * FROM notifications
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListBlocksForUser :many
+SELECT * FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListMutesForUser :many
+SELECT * FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListFollowsForUser :many
+SELECT * FROM user_follows
+WHERE follower_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListReportsByUser :many
+SELECT * FROM reports
+WHERE reporter_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListHandleHistoryForUser :many
+SELECT * FROM handle_history
+WHERE user_id = $1
+ORDER BY released_at ASC;
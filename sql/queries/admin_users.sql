@@ -0,0 +1,29 @@
+-- name: SearchUsersByEmail :many
+-- The search text is matched literally: LIKE wildcards in it are escaped.
+SELECT * FROM users
+WHERE email ILIKE '%' || REPLACE(REPLACE(REPLACE(sqlc.arg(email)::text, '\', '\\'), '%', '\%'), '_', '\_') || '%'
+ORDER BY email ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetChirpyRedGrant :exec
+UPDATE users
+SET chirpy_red_granted = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SuspendUser :one
+UPDATE users
+SET suspended_at = NOW(), suspension_reason = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_at = NULL, suspension_reason = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,34 @@
+-- name: BlockUser :exec
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: MuteUser :exec
+INSERT INTO user_mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteUser :execrows
+DELETE FROM user_mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: ListFilteredAuthors :many
+-- Blocks hide chirps both ways; mutes only hide the muted user's chirps.
+SELECT blocked_id FROM user_blocks
+WHERE blocker_id = sqlc.arg(user_id)
+UNION
+SELECT blocker_id FROM user_blocks
+WHERE blocked_id = sqlc.arg(user_id)
+UNION
+SELECT muted_id FROM user_mutes
+WHERE muter_id = sqlc.arg(user_id);
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+);
@@ -1,11 +1,12 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at,updated_at,body,user_id)
+INSERT INTO chirps (id, created_at,updated_at,body,user_id,publish_at)
 VALUES(
     gen_random_UUID(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    GREATEST(NOW(), $3)
 )
 RETURNING *;
 
@@ -14,18 +15,73 @@ DELETE FROM chirps *;
 
 -- name: GetAllChirps :many
 SELECT * FROM chirps
+WHERE publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
 ORDER BY created_at ASC;
 
 -- name: GetChirpFromID :one
 SELECT * FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL);
 
--- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1;
+-- name: GetChirpForAuthor :one
+-- Write paths check ownership themselves, and authors can still edit or
+-- delete chirps that moderation has hidden.
+SELECT * FROM chirps
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: SoftDeleteChirp :execrows
+UPDATE chirps
+SET deleted_at = NOW(), deleted_by = $2
+WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: GetChirpsFromAuthor :many
 SELECT *
 FROM chirps
-where user_id = $1
-ORDER BY created_at ASC;
\ No newline at end of file
+where user_id = $1 AND publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
+ORDER BY created_at ASC;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $1, updated_at = NOW()
+WHERE id = $2 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: GetChirpsPublishedAfter :many
+SELECT * FROM chirps
+WHERE (publish_at, id) > (sqlc.arg(publish_at)::timestamp, sqlc.arg(id)::uuid) AND publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
+ORDER BY publish_at ASC, id ASC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetScheduledChirpsDue :many
+SELECT * FROM chirps
+WHERE publish_at > created_at AND publish_at > $1 AND publish_at <= NOW() AND deleted_at IS NULL AND hidden_at IS NULL
+AND user_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL OR deletion_requested_at IS NOT NULL)
+ORDER BY publish_at ASC, id ASC;
+
+-- name: GetChirpIncludingDeleted :one
+SELECT * FROM chirps
+WHERE id = $1;
+
+-- name: ListDeletedChirps :many
+SELECT * FROM chirps
+WHERE deleted_at IS NOT NULL
+ORDER BY deleted_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, deleted_by = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: PurgeDeletedChirps :many
+WITH purged AS (
+    DELETE FROM chirps
+    WHERE deleted_at <= NOW() - make_interval(secs => sqlc.arg(retention_seconds)::float8)
+    RETURNING id
+)
+SELECT storage_key, thumbnail_key FROM media_attachments
+WHERE chirp_id IN (SELECT id FROM purged);
@@ -0,0 +1,16 @@
+-- name: FollowUser :execrows
+INSERT INTO user_follows (follower_id, followed_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :execrows
+DELETE FROM user_follows
+WHERE follower_id = $1 AND followed_id = $2;
+
+-- name: ListFollowedUsers :many
+SELECT followed_id FROM user_follows
+WHERE follower_id = $1;
+
+-- name: DeleteFollowsBetween :exec
+DELETE FROM user_follows
+WHERE (follower_id = $1 AND followed_id = $2) OR (follower_id = $2 AND followed_id = $1);
@@ -0,0 +1,13 @@
+-- name: ReleaseHandle :exec
+INSERT INTO handle_history (handle, user_id, released_at, expires_at)
+VALUES (sqlc.arg(handle), sqlc.arg(user_id), NOW(), NOW() + make_interval(secs => sqlc.arg(grace_seconds)::float8))
+ON CONFLICT ((LOWER(handle))) DO UPDATE
+SET handle = EXCLUDED.handle, user_id = EXCLUDED.user_id, released_at = EXCLUDED.released_at, expires_at = EXCLUDED.expires_at;
+
+-- name: GetHandleHistory :one
+SELECT * FROM handle_history
+WHERE LOWER(handle) = LOWER($1) AND expires_at > NOW();
+
+-- name: DeleteHandleHistory :exec
+DELETE FROM handle_history
+WHERE LOWER(handle) = LOWER($1);
@@ -0,0 +1,9 @@
+-- name: GetJobCursor :one
+SELECT position FROM job_cursors
+WHERE name = $1;
+
+-- name: SetJobCursor :exec
+-- The position is the database clock, which is what the jobs compare with.
+INSERT INTO job_cursors (name, position)
+VALUES ($1, NOW())
+ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position;
@@ -0,0 +1,20 @@
+-- name: CreateMediaAttachment :one
+INSERT INTO media_attachments (id, created_at, chirp_id, position, content_type, width, height, size_bytes, storage_key, thumbnail_key)
+VALUES (
+    gen_random_UUID(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING *;
+
+-- name: ListMediaForChirps :many
+SELECT * FROM media_attachments
+WHERE chirp_id = ANY($1::uuid[])
+ORDER BY chirp_id, position ASC;
@@ -0,0 +1,76 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, chirp_id, reporter_id, reason, details)
+VALUES (
+    gen_random_UUID(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (chirp_id, reporter_id) DO NOTHING
+RETURNING *;
+
+-- name: CountOpenReports :one
+SELECT COUNT(*) FROM reports
+WHERE chirp_id = $1 AND status = 'open';
+
+-- name: ListReportsForChirp :many
+SELECT * FROM reports
+WHERE chirp_id = $1
+ORDER BY created_at ASC;
+
+-- name: ResolveReports :execrows
+UPDATE reports
+SET status = $2, resolved_at = NOW()
+WHERE chirp_id = $1 AND status = 'open';
+
+-- name: AutoHideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW(), hide_source = 'auto'
+WHERE id = $1 AND hidden_at IS NULL;
+
+-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = COALESCE(hidden_at, NOW()), hide_source = 'moderator'
+WHERE id = $1;
+
+-- name: UnhideChirp :execrows
+UPDATE chirps
+SET hidden_at = NULL, hide_source = NULL
+WHERE id = $1 AND hidden_at IS NOT NULL;
+
+-- name: UnhideAutoHiddenChirp :execrows
+UPDATE chirps
+SET hidden_at = NULL, hide_source = NULL
+WHERE id = $1 AND hide_source = 'auto';
+
+-- name: ListModerationQueue :many
+SELECT chirps.id, chirps.body, chirps.user_id, chirps.hidden_at, chirps.deleted_at,
+    COUNT(reports.id) AS report_count,
+    MIN(reports.created_at)::timestamp AS first_reported_at,
+    ARRAY_AGG(DISTINCT reports.reason)::text[] AS reasons
+FROM reports
+JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.status = 'open'
+GROUP BY chirps.id
+ORDER BY report_count DESC, first_reported_at ASC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: CreateAuditLogEntry :exec
+INSERT INTO audit_log (id, created_at, actor_id, action, target_type, target_id, details)
+VALUES (
+    gen_random_UUID(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: ListAuditLog :many
+SELECT * FROM audit_log
+WHERE (sqlc.arg(target_id)::uuid = '00000000-0000-0000-0000-000000000000' OR target_id = sqlc.arg(target_id)::uuid)
+ORDER BY created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
@@ -0,0 +1,65 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (id, created_at, updated_at, url, secret, events, active)
+VALUES (
+    gen_random_UUID(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    TRUE
+)
+RETURNING *;
+
+-- name: GetWebhookSubscription :one
+SELECT * FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: ListWebhookSubscriptions :many
+SELECT * FROM webhook_subscriptions
+ORDER BY created_at ASC;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: EnqueueOutboundDeliveries :execrows
+INSERT INTO outbound_deliveries (id, created_at, subscription_id, event, payload, status, attempts, next_attempt_at)
+SELECT gen_random_UUID(), NOW(), webhook_subscriptions.id, sqlc.arg(event)::text, sqlc.arg(payload)::jsonb, 'pending', 0, NOW()
+FROM webhook_subscriptions
+WHERE webhook_subscriptions.active AND sqlc.arg(event)::text = ANY(webhook_subscriptions.events);
+
+-- name: ClaimDueDeliveries :many
+UPDATE outbound_deliveries
+SET next_attempt_at = NOW() + INTERVAL '2 minutes'
+WHERE id IN (
+    SELECT id FROM outbound_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkDeliverySucceeded :exec
+UPDATE outbound_deliveries
+SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = NOW()
+WHERE id = $1;
+
+-- name: MarkDeliveryFailed :exec
+UPDATE outbound_deliveries
+SET status = sqlc.arg(status), attempts = attempts + 1,
+    next_attempt_at = NOW() + make_interval(secs => sqlc.arg(backoff_seconds)::float8),
+    last_status_code = sqlc.arg(last_status_code), last_error = sqlc.arg(last_error)
+WHERE id = sqlc.arg(id);
+
+-- name: ListDeadDeliveries :many
+SELECT * FROM outbound_deliveries
+WHERE status = 'dead'
+ORDER BY created_at DESC
+LIMIT $1 OFFSET $2;
+
+-- name: RetryDeadDelivery :execrows
+UPDATE outbound_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+WHERE id = $1 AND status = 'dead';
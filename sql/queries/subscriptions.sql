@@ -0,0 +1,60 @@
+-- name: StartSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, current_period_start, current_period_end, cancelled_at)
+VALUES (
+    gen_random_UUID(),
+    NOW(),
+    NOW(),
+    $1,
+    'active',
+    $2,
+    $3,
+    NULL
+)
+ON CONFLICT (user_id)
+DO UPDATE SET status = 'active', current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end, cancelled_at = NULL, updated_at = NOW()
+RETURNING *;
+
+-- name: RenewSubscription :execrows
+UPDATE subscriptions
+SET status = 'active', current_period_start = $2, current_period_end = $3, cancelled_at = NULL, updated_at = NOW()
+WHERE user_id = $1;
+
+-- name: CancelSubscription :execrows
+UPDATE subscriptions
+SET status = 'cancelled', cancelled_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND status = 'active';
+
+-- name: EndSubscription :execrows
+UPDATE subscriptions
+SET status = 'expired', current_period_end = LEAST(current_period_end, NOW()), updated_at = NOW()
+WHERE user_id = $1 AND status <> 'expired';
+
+-- name: GetSubscriptionForUser :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: ExpireLapsedSubscriptions :execrows
+UPDATE subscriptions
+SET status = 'expired', updated_at = NOW()
+WHERE status <> 'expired' AND current_period_end <= NOW();
+
+-- name: SyncChirpyRed :exec
+UPDATE users
+SET is_chirpy_red = chirpy_red_granted OR EXISTS (
+    SELECT 1 FROM subscriptions
+    WHERE subscriptions.user_id = users.id
+    AND subscriptions.status <> 'expired'
+    AND subscriptions.current_period_end > NOW()
+), updated_at = NOW()
+WHERE id = $1;
+
+-- name: SyncAllChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = FALSE, updated_at = NOW()
+WHERE is_chirpy_red AND NOT chirpy_red_granted AND NOT EXISTS (
+    SELECT 1 FROM subscriptions
+    WHERE subscriptions.user_id = users.id
+    AND subscriptions.status <> 'expired'
+    AND subscriptions.current_period_end > NOW()
+);
@@ -26,4 +26,70 @@ RETURNING *;
 -- name: UpgrateToChirpyRed :exec
 UPDATE users
 SET is_chirpy_red = TRUE
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+RETURNING *;
+
+-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SetTOTPSecret :exec
+UPDATE users
+SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL;
+
+-- name: EnableTOTP :exec
+UPDATE users
+SET totp_enabled_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $1
+WHERE id = $2 AND totp_last_step < $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE LOWER(handle) = LOWER($1);
+
+-- name: GetUsersByIDs :many
+SELECT * FROM users
+WHERE id = ANY($1::uuid[]);
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name = $1, bio = $2, updated_at = NOW()
+WHERE id = $3
+RETURNING *;
+
+-- name: SetUserHandle :one
+UPDATE users
+SET handle = sqlc.arg(handle),
+    handle_changed_at = CASE WHEN sqlc.arg(start_cooldown)::boolean THEN NOW() ELSE handle_changed_at END,
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: SetUserAvatar :exec
+UPDATE users
+SET avatar_key = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: GetAccountStatus :one
+SELECT suspended_at, suspension_reason, deletion_requested_at FROM users
+WHERE id = $1;
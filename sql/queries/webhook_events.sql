@@ -0,0 +1,36 @@
+-- name: RecordWebhookEvent :execrows
+INSERT INTO webhook_events (id, created_at, source, event)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3
+)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, received_at, source, event_id, event, headers, body, outcome, status_code, error, replay_of)
+VALUES (
+    gen_random_UUID(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+)
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE (sqlc.arg(outcome)::text = '' OR outcome = sqlc.arg(outcome)::text)
+ORDER BY received_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE webhook_events(
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    source TEXT NOT NULL,
+    event TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE subscriptions(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE,
+    -- active, cancelled (runs until the period ends) or expired
+    status TEXT NOT NULL,
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    cancelled_at TIMESTAMP,
+FOREIGN KEY (user_id)
+REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- existing Chirpy Red members get one period to receive a renewal event
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, current_period_start, current_period_end)
+SELECT gen_random_UUID(), NOW(), NOW(), id, 'active', NOW(), NOW() + INTERVAL '1 month'
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
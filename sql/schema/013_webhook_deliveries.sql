@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE webhook_deliveries(
+    id UUID PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL,
+    source TEXT NOT NULL,
+    event_id TEXT,
+    event TEXT,
+    headers JSONB NOT NULL,
+    body TEXT NOT NULL,
+    -- processed, duplicate, ignored, rejected, invalid or failed
+    outcome TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    error TEXT,
+    replay_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL
+);
+
+CREATE INDEX webhook_deliveries_received_at_idx ON webhook_deliveries (received_at DESC);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
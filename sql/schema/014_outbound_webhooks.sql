@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE webhook_subscriptions(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    url TEXT NOT NULL,
+    -- kept in plain text, it is needed to sign every delivery
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE TABLE outbound_deliveries(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    subscription_id UUID NOT NULL,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    -- pending, delivered or dead
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INTEGER,
+    last_error TEXT,
+    delivered_at TIMESTAMP,
+FOREIGN KEY (subscription_id)
+REFERENCES webhook_subscriptions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX outbound_deliveries_due_idx ON outbound_deliveries (next_attempt_at)
+WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE outbound_deliveries;
+DROP TABLE webhook_subscriptions;
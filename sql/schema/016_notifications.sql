@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE notifications(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    actor_id UUID,
+    type TEXT NOT NULL,
+    chirp_id UUID,
+    read_at TIMESTAMP,
+FOREIGN KEY (user_id)
+REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (actor_id)
+REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (chirp_id)
+REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_created_idx ON notifications (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE notifications;
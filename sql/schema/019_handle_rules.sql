@@ -0,0 +1,52 @@
+-- +goose Up
+ALTER TABLE users
+DROP CONSTRAINT users_handle_key,
+ADD COLUMN handle_changed_at TIMESTAMP;
+
+-- Handles set before these rules existed may break them. Clear the ones that
+-- fail internal/handles.Validate (reserved names as of this migration), then
+-- keep only the oldest account of each case-insensitive duplicate. Cleared
+-- users simply pick a new handle.
+UPDATE users
+SET handle = NULL, updated_at = NOW()
+WHERE handle IS NOT NULL AND (
+    handle !~ '^[A-Za-z0-9_]{3,30}$'
+    OR handle !~ '[A-Za-z]'
+    OR LOWER(handle) IN (
+        'about', 'admin', 'administrator', 'api', 'app', 'assets', 'auth',
+        'chirpy', 'help', 'login', 'logout', 'me', 'media', 'moderator', 'null',
+        'oauth', 'polka', 'root', 'security', 'settings', 'signup', 'staff',
+        'status', 'support', 'system', 'undefined', 'www'
+    )
+);
+
+UPDATE users
+SET handle = NULL, updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY LOWER(handle) ORDER BY created_at ASC, id ASC) AS position
+        FROM users
+        WHERE handle IS NOT NULL
+    ) ranked
+    WHERE position > 1
+);
+
+CREATE UNIQUE INDEX users_handle_lower_idx ON users (LOWER(handle));
+
+CREATE TABLE handle_history(
+    handle TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    released_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+FOREIGN KEY (user_id)
+REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX handle_history_lower_idx ON handle_history (LOWER(handle));
+
+-- +goose Down
+DROP TABLE handle_history;
+DROP INDEX users_handle_lower_idx;
+ALTER TABLE users
+DROP COLUMN handle_changed_at,
+ADD CONSTRAINT users_handle_key UNIQUE (handle);
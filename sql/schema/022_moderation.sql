@@ -0,0 +1,42 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP;
+
+CREATE TABLE reports(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    chirp_id UUID NOT NULL,
+    reporter_id UUID NOT NULL,
+    -- spam, harassment, hate, violence, sexual, misinformation or other
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    -- open, dismissed or actioned
+    status TEXT NOT NULL DEFAULT 'open',
+    resolved_at TIMESTAMP,
+UNIQUE (chirp_id, reporter_id),
+FOREIGN KEY (chirp_id)
+REFERENCES chirps(id) ON DELETE CASCADE,
+FOREIGN KEY (reporter_id)
+REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX reports_open_idx ON reports (chirp_id) WHERE status = 'open';
+
+CREATE TABLE audit_log(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    -- NULL for actions taken by the system or with the shared admin key
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id UUID NOT NULL,
+    details JSONB NOT NULL
+);
+
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE audit_log;
+DROP TABLE reports;
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+-- Chirpy Red granted by an admin, independent of any subscription
+ADD COLUMN chirpy_red_granted BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN suspended_at TIMESTAMP,
+ADD COLUMN suspension_reason TEXT;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN role,
+DROP COLUMN chirpy_red_granted,
+DROP COLUMN suspended_at,
+DROP COLUMN suspension_reason;
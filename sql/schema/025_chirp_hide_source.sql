@@ -0,0 +1,18 @@
+-- +goose Up
+-- 'auto' when enough reports hid the chirp, 'moderator' when a moderator did
+ALTER TABLE chirps
+ADD COLUMN hide_source TEXT;
+
+UPDATE chirps
+SET hide_source = CASE
+    WHEN EXISTS (
+        SELECT 1 FROM audit_log
+        WHERE audit_log.target_id = chirps.id AND audit_log.action = 'chirp.hide'
+    ) THEN 'moderator'
+    ELSE 'auto'
+END
+WHERE hidden_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN hide_source;
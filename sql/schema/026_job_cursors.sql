@@ -0,0 +1,9 @@
+-- +goose Up
+-- How far each background job has got, so a restart resumes instead of skipping
+CREATE TABLE job_cursors (
+    name TEXT PRIMARY KEY,
+    position TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE job_cursors;
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/Dirza1/Chirpy/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+const (
+	chirpsTopic       = "chirps"
+	streamBuffer      = 64
+	streamHeartbeat   = 15 * time.Second
+	scheduledInterval = 10 * time.Second
+	scheduledCursor   = "publish scheduled chirps"
+	// replayLimit caps how many missed chirps are replayed on resume;
+	// clients further behind than that are told to resync instead.
+	replayLimit = 500
+)
+
+type streamedChirp struct {
+	Id         uuid.UUID   `json:"id"`
+	Created_at time.Time   `json:"created_at"`
+	Updated_at time.Time   `json:"updated_at"`
+	Body       string      `json:"body"`
+	User_id    uuid.UUID   `json:"user_id"`
+	Publish_at time.Time   `json:"publish_at"`
+	Media      []mediaJSON `json:"media"`
+	Author     authorJSON  `json:"author"`
+}
+
+func toStreamedChirp(chirp database.Chirp, attachments []mediaJSON, author authorJSON) streamedChirp {
+	return streamedChirp{
+		Id:         chirp.ID,
+		Created_at: chirp.CreatedAt,
+		Updated_at: chirp.UpdatedAt,
+		Body:       chirp.Body,
+		User_id:    chirp.UserID,
+		Publish_at: chirp.PublishAt,
+		Media:      attachments,
+		Author:     author,
+	}
+}
+
+func chirpMessage(chirp database.Chirp, attachments []mediaJSON, author authorJSON) (pubsub.Message, error) {
+	data, err := json.Marshal(toStreamedChirp(chirp, attachments, author))
+	if err != nil {
+		return pubsub.Message{}, err
+	}
+	return pubsub.Message{ID: chirp.ID.String(), Event: "chirp", Data: data}, nil
+}
+
+// publishChirp pushes a chirp that just went live to every open stream.
+func (cfg *apiConfig) publishChirp(ctx context.Context, chirp database.Chirp) {
+	attachments, err := cfg.mediaForChirps(ctx, []database.Chirp{chirp})
+	if err != nil {
+		log.Printf("error loading media of chirp %s for the stream: %s", chirp.ID, err)
+		return
+	}
+	authors, err := cfg.authorsForChirps(ctx, []database.Chirp{chirp})
+	if err != nil {
+		log.Printf("error loading author of chirp %s for the stream: %s", chirp.ID, err)
+		return
+	}
+	msg, err := chirpMessage(chirp, attachments[chirp.ID], authors[chirp.UserID])
+	if err != nil {
+		log.Printf("error encoding chirp %s for the stream: %s", chirp.ID, err)
+		return
+	}
+	cfg.Hub.Publish(chirpsTopic, msg)
+}
+
+// publishScheduledChirps returns a job that announces scheduled chirps on the
+// bus and sends their chirp.created webhook once their publish time has
+// passed.
+// Its cursor is stored in the database so chirps that came due while the
+// server was down are still published after a restart. The cursor is the
+// database clock, read once inside a single transaction, so the window is
+// never compared against the Go clock.
+func (cfg *apiConfig) publishScheduledChirps() func(context.Context) error {
+	return func(ctx context.Context) error {
+		// Queue the webhooks and advance the cursor together so a failure
+		// retries the whole batch instead of dropping or repeating events.
+		tx, err := cfg.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		queries := cfg.Queries.WithTx(tx)
+
+		last, err := queries.GetJobCursor(ctx, scheduledCursor)
+		if errors.Is(err, sql.ErrNoRows) {
+			// First run: start the window now rather than replaying history.
+			err = queries.SetJobCursor(ctx, scheduledCursor)
+			if err != nil {
+				return err
+			}
+			return tx.Commit()
+		} else if err != nil {
+			return err
+		}
+		due, err := queries.GetScheduledChirpsDue(ctx, last)
+		if err != nil {
+			return err
+		}
+		attachments, err := cfg.mediaForChirps(ctx, due)
+		if err != nil {
+			return err
+		}
+		authors, err := cfg.authorsForChirps(ctx, due)
+		if err != nil {
+			return err
+		}
+		for _, chirp := range due {
+			payload := toStreamedChirp(chirp, attachments[chirp.ID], authors[chirp.UserID])
+			err = enqueueWebhookEvent(ctx, queries, eventChirpCreated, payload)
+			if err != nil {
+				return err
+			}
+		}
+		err = queries.SetJobCursor(ctx, scheduledCursor)
+		if err != nil {
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		for _, chirp := range due {
+			cfg.emit(ctx, busChirpPublished, chirp)
+		}
+		return nil
+	}
+}
+
+func (cfg *apiConfig) stream_chirps(writer http.ResponseWriter, request *http.Request) {
+	authors := map[uuid.UUID]bool{}
+	for _, raw := range request.URL.Query()["author_id"] {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			respondWithError(writer, 400, "invalid author_id")
+			return
+		}
+		authors[id] = true
+	}
+	// following=true narrows the stream to the users the caller follows.
+	var followed map[uuid.UUID]bool
+	if request.URL.Query().Get("following") == "true" {
+		viewer, err := cfg.authenticate(request, auth.ScopeChirpsRead)
+		if err != nil {
+			respondWithError(writer, 401, "incorrect or missing login token")
+			return
+		}
+		followed, err = cfg.followedUsers(request, viewer)
+		if err != nil {
+			respondWithError(writer, 500, "error loading stream")
+			return
+		}
+	}
+	filter, err := cfg.requestChirpFilter(request)
+	if err != nil {
+		respondWithError(writer, 500, "error loading stream")
+		return
+	}
+	wanted := func(userID uuid.UUID) bool {
+		return (len(authors) == 0 || authors[userID]) &&
+			(followed == nil || followed[userID]) &&
+			filter.allows(userID)
+	}
+
+	// Subscribe before catching up so nothing published in between is lost.
+	sub := cfg.Hub.Subscribe(chirpsTopic, streamBuffer)
+	defer cfg.Hub.Unsubscribe(sub)
+
+	controller := http.NewResponseController(writer)
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(200)
+
+	sent := map[string]bool{}
+	missed, resync := cfg.missedChirps(request)
+	if resync {
+		// The gap cannot be replayed; the client reloads the timeline instead.
+		_, err = fmt.Fprint(writer, "event: resync\ndata: {}\n\n")
+		if err != nil {
+			return
+		}
+	}
+	attachments, err := cfg.mediaForChirps(request.Context(), missed)
+	if err != nil {
+		log.Printf("error loading media of missed chirps: %s", err)
+		return
+	}
+	missedAuthors, err := cfg.authorsForChirps(request.Context(), missed)
+	if err != nil {
+		log.Printf("error loading authors of missed chirps: %s", err)
+		return
+	}
+	for _, chirp := range missed {
+		if !wanted(chirp.UserID) {
+			continue
+		}
+		msg, err := chirpMessage(chirp, attachments[chirp.ID], missedAuthors[chirp.UserID])
+		if err != nil {
+			continue
+		}
+		if writeEvent(writer, msg) != nil {
+			return
+		}
+		sent[msg.ID] = true
+	}
+	if controller.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(writer, ": ping\n\n")
+		case msg, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the client resumes via Last-Event-ID.
+				return
+			}
+			if sent[msg.ID] {
+				continue
+			}
+			var chirp streamedChirp
+			if json.Unmarshal(msg.Data, &chirp) != nil || !wanted(chirp.User_id) {
+				continue
+			}
+			err = writeEvent(writer, msg)
+		}
+		if err != nil || controller.Flush() != nil {
+			return
+		}
+	}
+}
+
+// missedChirps returns the chirps published after the one named in the
+// Last-Event-ID header, or nothing when the client is not resuming. resync
+// is true when the gap cannot be replayed: the last chirp is gone or hidden,
+// or more than replayLimit chirps were missed.
+func (cfg *apiConfig) missedChirps(request *http.Request) (missed []database.Chirp, resync bool) {
+	lastID := request.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		return nil, false
+	}
+	id, err := uuid.Parse(lastID)
+	if err != nil {
+		return nil, true
+	}
+	last, err := cfg.Queries.GetChirpFromID(request.Context(), id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("error loading last seen chirp: %s", err)
+		}
+		return nil, true
+	}
+	// One extra row tells us the replay would have been cut short.
+	missed, err = cfg.Queries.GetChirpsPublishedAfter(request.Context(), database.GetChirpsPublishedAfterParams{
+		PublishAt: last.PublishAt,
+		ID:        last.ID,
+		RowLimit:  replayLimit + 1,
+	})
+	if err != nil {
+		log.Printf("error loading missed chirps: %s", err)
+		return nil, true
+	}
+	if len(missed) > replayLimit {
+		return nil, true
+	}
+	return missed, false
+}
+
+func writeEvent(writer http.ResponseWriter, msg pubsub.Message) error {
+	_, err := fmt.Fprintf(writer, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event, msg.Data)
+	return err
+}
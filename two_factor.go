@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/database"
+)
+
+const (
+	twoFactorChallengeExpiry = 5 * time.Minute
+	recoveryCodeCount        = 10
+	totpIssuer               = "Chirpy"
+)
+
+func (cfg *apiConfig) respondWithTwoFactorChallenge(writer http.ResponseWriter, user database.User) {
+	challenge, err := auth.MakeTwoFactorChallenge(user.ID, cfg.SecretToken, twoFactorChallengeExpiry)
+	if err != nil {
+		respondWithError(writer, 500, "error during challenge generation")
+		return
+	}
+	type returnjason struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+	returning := returnjason{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) setup_2fa(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 404, "user not found")
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(writer, 409, "two-factor authentication is already enabled")
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(writer, 500, "error generating secret")
+		return
+	}
+	params := database.SetTOTPSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		ID:         user.ID,
+	}
+	err = cfg.Queries.SetTOTPSecret(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error storing secret")
+		return
+	}
+	type returnjason struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+	returning := returnjason{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) confirm_2fa(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		Code string `json:"code"`
+	}
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err = decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	user, err := cfg.Queries.GetUserByID(request.Context(), userID)
+	if err != nil {
+		respondWithError(writer, 404, "user not found")
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(writer, 409, "two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(writer, 400, "two-factor setup has not been started")
+		return
+	}
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, inc.Code, time.Now())
+	if !ok {
+		respondWithError(writer, 400, "incorrect code")
+		return
+	}
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(writer, 500, "error generating recovery codes")
+		return
+	}
+	tx, err := cfg.DB.BeginTx(request.Context(), nil)
+	if err != nil {
+		respondWithError(writer, 500, "error starting transaction")
+		return
+	}
+	defer tx.Rollback()
+	queries := cfg.Queries.WithTx(tx)
+	err = queries.DeleteRecoveryCodesForUser(request.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error storing recovery codes")
+		return
+	}
+	for _, code := range codes {
+		params := database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashToken(code),
+			UserID:   user.ID,
+		}
+		err = queries.CreateRecoveryCode(request.Context(), params)
+		if err != nil {
+			respondWithError(writer, 500, "error storing recovery codes")
+			return
+		}
+	}
+	_, err = queries.UseTOTPStep(request.Context(), database.UseTOTPStepParams{TotpLastStep: step, ID: user.ID})
+	if err != nil {
+		respondWithError(writer, 500, "error enabling two-factor authentication")
+		return
+	}
+	err = queries.EnableTOTP(request.Context(), user.ID)
+	if err != nil {
+		respondWithError(writer, 500, "error enabling two-factor authentication")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(writer, 500, "error enabling two-factor authentication")
+		return
+	}
+	type returnjason struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	respondWithJSON(writer, 200, returnjason{RecoveryCodes: codes})
+}
+
+// login_2fa finishes a login started with a challenge token by checking
+// either a TOTP code or one of the user's recovery codes.
+func (cfg *apiConfig) login_2fa(writer http.ResponseWriter, request *http.Request) {
+	type incomming struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	decoder := json.NewDecoder(request.Body)
+	inc := incomming{}
+	err := decoder.Decode(&inc)
+	if err != nil {
+		respondWithError(writer, 400, "error decoding the incomming json")
+		return
+	}
+	userID, err := auth.ValidateTwoFactorChallenge(inc.ChallengeToken, cfg.SecretToken)
+	if err != nil {
+		respondWithError(writer, 401, "invalid or expired challenge token")
+		return
+	}
+	limiterKey := "2fa:" + userID.String()
+	if wait, ok := cfg.LoginAccountLimiter.Allow(limiterKey); !ok {
+		respondTooManyRequests(writer, wait)
+		return
+	}
+	defer cfg.LoginAccountLimiter.Done(limiterKey)
+	user, err := cfg.Queries.GetUserByID(request.Context(), userID)
+	if err != nil || !user.TotpEnabledAt.Valid {
+		respondWithError(writer, 401, "invalid or expired challenge token")
+		return
+	}
+	if inc.RecoveryCode != "" {
+		params := database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(strings.ToLower(strings.TrimSpace(inc.RecoveryCode))),
+		}
+		used, err := cfg.Queries.UseRecoveryCode(request.Context(), params)
+		if err != nil || used != 1 {
+			cfg.LoginAccountLimiter.Fail(limiterKey)
+			respondWithError(writer, 401, "incorrect code")
+			return
+		}
+	} else {
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, inc.Code, time.Now())
+		if !ok {
+			cfg.LoginAccountLimiter.Fail(limiterKey)
+			respondWithError(writer, 401, "incorrect code")
+			return
+		}
+		// a code can only be used once, even while it is still valid
+		used, err := cfg.Queries.UseTOTPStep(request.Context(), database.UseTOTPStepParams{TotpLastStep: step, ID: user.ID})
+		if err != nil || used != 1 {
+			cfg.LoginAccountLimiter.Fail(limiterKey)
+			respondWithError(writer, 401, "incorrect code")
+			return
+		}
+	}
+	cfg.LoginAccountLimiter.Reset(limiterKey)
+	cfg.respondWithSession(writer, request, user)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Outcomes recorded for every inbound webhook delivery.
+const (
+	webhookProcessed = "processed"
+	webhookDuplicate = "duplicate"
+	webhookIgnored   = "ignored"
+	webhookRejected  = "rejected"
+	webhookInvalid   = "invalid"
+	webhookFailed    = "failed"
+)
+
+type webhookResult struct {
+	outcome    string
+	statusCode int
+	err        error
+	eventID    string
+	event      string
+}
+
+func respondWithWebhookResult(writer http.ResponseWriter, result webhookResult) {
+	if result.err != nil {
+		respondWithError(writer, result.statusCode, result.err.Error())
+		return
+	}
+	respondWithJSON(writer, result.statusCode, nil)
+}
+
+// redactedWebhookHeaders are never written to the delivery log.
+var redactedWebhookHeaders = []string{"Authorization", "Cookie"}
+
+// logWebhookDelivery records a delivery and how it was handled. Rejected
+// deliveries are unauthenticated and cannot be replayed, so their headers and
+// body are not kept.
+func (cfg *apiConfig) logWebhookDelivery(ctx context.Context, source string, headers http.Header, body []byte, result webhookResult, replayOf uuid.NullUUID) {
+	if result.outcome == webhookRejected {
+		headers, body = http.Header{}, nil
+	}
+	stored := headers.Clone()
+	for _, name := range redactedWebhookHeaders {
+		if stored.Get(name) != "" {
+			stored.Set(name, "[redacted]")
+		}
+	}
+	headerJSON, err := json.Marshal(stored)
+	if err != nil {
+		headerJSON = []byte("{}")
+	}
+	params := database.CreateWebhookDeliveryParams{
+		Source:     source,
+		EventID:    sql.NullString{String: result.eventID, Valid: result.eventID != ""},
+		Event:      sql.NullString{String: result.event, Valid: result.event != ""},
+		Headers:    headerJSON,
+		Body:       string(body),
+		Outcome:    result.outcome,
+		StatusCode: int32(result.statusCode),
+		ReplayOf:   replayOf,
+	}
+	if result.err != nil {
+		params.Error = sql.NullString{String: result.err.Error(), Valid: true}
+	}
+	_, err = cfg.Queries.CreateWebhookDelivery(ctx, params)
+	if err != nil {
+		log.Printf("error logging %s webhook delivery: %s", source, err)
+	}
+}
+
+type webhookDeliveryJSON struct {
+	ID         uuid.UUID       `json:"id"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Source     string          `json:"source"`
+	EventID    string          `json:"event_id,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Outcome    string          `json:"outcome"`
+	StatusCode int32           `json:"status_code"`
+	Error      string          `json:"error,omitempty"`
+	ReplayOf   *uuid.UUID      `json:"replay_of,omitempty"`
+	Headers    json.RawMessage `json:"headers,omitempty"`
+	Body       string          `json:"body,omitempty"`
+}
+
+func toWebhookDeliveryJSON(delivery database.WebhookDelivery, full bool) webhookDeliveryJSON {
+	returning := webhookDeliveryJSON{
+		ID:         delivery.ID,
+		ReceivedAt: delivery.ReceivedAt,
+		Source:     delivery.Source,
+		EventID:    delivery.EventID.String,
+		Event:      delivery.Event.String,
+		Outcome:    delivery.Outcome,
+		StatusCode: delivery.StatusCode,
+		Error:      delivery.Error.String,
+	}
+	if delivery.ReplayOf.Valid {
+		returning.ReplayOf = &delivery.ReplayOf.UUID
+	}
+	if full {
+		returning.Headers = delivery.Headers
+		returning.Body = delivery.Body
+	}
+	return returning
+}
+
+func (cfg *apiConfig) admin_list_webhooks(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	limit, offset := pagination(request)
+	params := database.ListWebhookDeliveriesParams{
+		Outcome:   request.URL.Query().Get("outcome"),
+		RowLimit:  limit,
+		RowOffset: offset,
+	}
+	deliveries, err := cfg.Queries.ListWebhookDeliveries(request.Context(), params)
+	if err != nil {
+		respondWithError(writer, 500, "error retrieving webhook deliveries")
+		return
+	}
+	returning := []webhookDeliveryJSON{}
+	for _, delivery := range deliveries {
+		returning = append(returning, toWebhookDeliveryJSON(delivery, false))
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+func (cfg *apiConfig) admin_get_webhook(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	id, err := uuid.Parse(request.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	delivery, err := cfg.Queries.GetWebhookDelivery(request.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "webhook delivery not found")
+		return
+	}
+	respondWithJSON(writer, 200, toWebhookDeliveryJSON(delivery, true))
+}
+
+// admin_replay_webhook runs a stored delivery through processing again.
+// Rejected deliveries never passed signature verification and cannot be
+// replayed; already processed events are skipped by the idempotency check.
+func (cfg *apiConfig) admin_replay_webhook(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := cfg.requireAdmin(writer, request); !ok {
+		return
+	}
+	id, err := uuid.Parse(request.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(writer, 400, "Error during ID parsing")
+		return
+	}
+	delivery, err := cfg.Queries.GetWebhookDelivery(request.Context(), id)
+	if err != nil {
+		respondWithError(writer, 404, "webhook delivery not found")
+		return
+	}
+	if delivery.Outcome == webhookRejected {
+		respondWithError(writer, 409, "rejected deliveries cannot be replayed")
+		return
+	}
+	if delivery.Source != "polka" {
+		respondWithError(writer, 400, "unknown webhook source")
+		return
+	}
+	body := []byte(delivery.Body)
+	result := cfg.processPolkaEvent(request.Context(), body)
+	headers := http.Header{}
+	_ = json.Unmarshal(delivery.Headers, &headers)
+	replayOf := uuid.NullUUID{UUID: delivery.ID, Valid: true}
+	cfg.logWebhookDelivery(request.Context(), delivery.Source, headers, body, result, replayOf)
+	type returnjason struct {
+		Outcome    string `json:"outcome"`
+		StatusCode int    `json:"status_code"`
+		Error      string `json:"error,omitempty"`
+	}
+	returning := returnjason{
+		Outcome:    result.outcome,
+		StatusCode: result.statusCode,
+	}
+	if result.err != nil {
+		returning.Error = result.err.Error()
+	}
+	respondWithJSON(writer, 200, returning)
+}
+
+// pagination reads the limit and offset query parameters, capping the page
+// size at 100.
+func pagination(request *http.Request) (int32, int32) {
+	limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(request.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return int32(limit), int32(offset)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dirza1/Chirpy/internal/auth"
+	"github.com/Dirza1/Chirpy/internal/pubsub"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait    = 10 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsPingInterval = 50 * time.Second
+	wsMaxMessage   = 4096
+	// wsSendBuffer bounds how far a client may fall behind before the server
+	// gives up on it rather than buffering without limit.
+	wsSendBuffer = 64
+	// wsTicketTTL is how long a handshake ticket stays usable.
+	wsTicketTTL = 30 * time.Second
+	// wsStatusInterval is how often an open connection re-checks that its
+	// account is still allowed in.
+	wsStatusInterval = time.Minute
+)
+
+// wsTickets holds short-lived, single-use tickets for the WebSocket
+// handshake. Browsers cannot set headers on it, and a ticket in the URL is
+// far less useful to whoever reads an access log than the access token.
+type wsTickets struct {
+	mu      sync.Mutex
+	tickets map[string]wsTicket
+}
+
+type wsTicket struct {
+	userID    uuid.UUID
+	expiresAt time.Time
+}
+
+func newWSTickets() *wsTickets {
+	return &wsTickets{tickets: map[string]wsTicket{}}
+}
+
+func (t *wsTickets) issue(userID uuid.UUID) (string, time.Time, error) {
+	ticket, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(wsTicketTTL)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, existing := range t.tickets {
+		if now.After(existing.expiresAt) {
+			delete(t.tickets, key)
+		}
+	}
+	t.tickets[auth.HashToken(ticket)] = wsTicket{userID: userID, expiresAt: expiresAt}
+	return ticket, expiresAt, nil
+}
+
+// redeem returns the user a ticket was issued to and invalidates it.
+func (t *wsTickets) redeem(ticket string) (uuid.UUID, bool) {
+	key := auth.HashToken(ticket)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	issued, ok := t.tickets[key]
+	delete(t.tickets, key)
+	if !ok || time.Now().After(issued.expiresAt) {
+		return uuid.Nil, false
+	}
+	return issued.userID, true
+}
+
+// checkWSOrigin accepts handshakes without an Origin header, which only
+// non-browser clients send, and browsers on WS_ALLOWED_ORIGINS or, when that
+// is unset, on the API's own host.
+func (cfg *apiConfig) checkWSOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(cfg.WSAllowedOrigins) == 0 {
+		parsed, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(parsed.Host, request.Host)
+	}
+	return slices.Contains(cfg.WSAllowedOrigins, origin)
+}
+
+func (cfg *apiConfig) websocket_ticket(writer http.ResponseWriter, request *http.Request) {
+	userID, err := cfg.authenticate(request, "")
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	ticket, expiresAt, err := cfg.WSTickets.issue(userID)
+	if err != nil {
+		respondWithError(writer, 500, "error issuing ticket")
+		return
+	}
+	type returnjason struct {
+		Ticket     string    `json:"ticket"`
+		Expires_at time.Time `json:"expires_at"`
+	}
+	respondWithJSON(writer, 201, returnjason{Ticket: ticket, Expires_at: expiresAt})
+}
+
+// notificationsTopic is the hub topic carrying one user's notifications.
+func notificationsTopic(userID uuid.UUID) string {
+	return "notifications:" + userID.String()
+}
+
+type wsClientMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+}
+
+type wsServerMessage struct {
+	Type  string          `json:"type"`
+	Topic string          `json:"topic,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type wsConn struct {
+	cfg    *apiConfig
+	conn   *websocket.Conn
+	userID uuid.UUID
+	send   chan wsServerMessage
+	done   chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	subs   map[string]*pubsub.Subscription
+	closed bool
+}
+
+func (cfg *apiConfig) websocket(writer http.ResponseWriter, request *http.Request) {
+	var userID uuid.UUID
+	token, err := auth.GetBearerToken(request.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.SecretToken)
+	} else {
+		// Browsers cannot set headers on a WebSocket handshake.
+		var ok bool
+		userID, ok = cfg.WSTickets.redeem(request.URL.Query().Get("ticket"))
+		if !ok {
+			err = errors.New("invalid or expired ticket")
+		}
+	}
+	if err != nil {
+		respondWithError(writer, 401, "incorrect or missing login token")
+		return
+	}
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     cfg.checkWSOrigin,
+	}
+	conn, err := upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		// Upgrade has already written the error response.
+		return
+	}
+	c := &wsConn{
+		cfg:    cfg,
+		conn:   conn,
+		userID: userID,
+		send:   make(chan wsServerMessage, wsSendBuffer),
+		done:   make(chan struct{}),
+		subs:   map[string]*pubsub.Subscription{},
+	}
+	c.subscribe("notifications")
+	go c.writeLoop()
+	go c.watchAccount()
+	c.readLoop()
+}
+
+// resolveTopic maps a topic name from the client onto a hub topic, and
+// reports whether the client may subscribe to it.
+func (c *wsConn) resolveTopic(topic string) (string, bool) {
+	switch {
+	case topic == "notifications":
+		return notificationsTopic(c.userID), true
+	case topic == chirpsTopic:
+		return chirpsTopic, true
+	case strings.HasPrefix(topic, "chirps:"):
+		_, err := uuid.Parse(strings.TrimPrefix(topic, "chirps:"))
+		return chirpsTopic, err == nil
+	}
+	return "", false
+}
+
+func (c *wsConn) subscribe(topic string) {
+	hubTopic, ok := c.resolveTopic(topic)
+	if !ok {
+		c.queue(wsServerMessage{Type: "error", Topic: topic, Error: "unknown topic"})
+		return
+	}
+	c.mu.Lock()
+	if c.closed {
+		// close has already released every subscription; a new one would leak.
+		c.mu.Unlock()
+		return
+	}
+	if _, ok := c.subs[topic]; ok {
+		c.mu.Unlock()
+		c.queue(wsServerMessage{Type: "subscribed", Topic: topic})
+		return
+	}
+	sub := c.cfg.Hub.Subscribe(hubTopic, wsSendBuffer)
+	c.subs[topic] = sub
+	c.mu.Unlock()
+
+	var author string
+	if strings.HasPrefix(topic, "chirps:") {
+		author = strings.TrimPrefix(topic, "chirps:")
+	}
+	var filter chirpFilter
+	if hubTopic == chirpsTopic {
+		// Blocks and mutes made later apply from the next subscription.
+		var err error
+		filter, err = c.cfg.chirpFilterFor(context.Background(), c.userID)
+		if err != nil {
+			log.Printf("error loading chirp filter: %s", err)
+		}
+	}
+	go c.forward(topic, author, filter, sub)
+	c.queue(wsServerMessage{Type: "subscribed", Topic: topic})
+}
+
+func (c *wsConn) unsubscribe(topic string) {
+	c.mu.Lock()
+	sub, ok := c.subs[topic]
+	delete(c.subs, topic)
+	c.mu.Unlock()
+	if ok {
+		c.cfg.Hub.Unsubscribe(sub)
+	}
+	c.queue(wsServerMessage{Type: "unsubscribed", Topic: topic})
+}
+
+// forward relays hub messages for one subscription onto the connection.
+func (c *wsConn) forward(topic, author string, filter chirpFilter, sub *pubsub.Subscription) {
+	for msg := range sub.C {
+		if author != "" || len(filter) > 0 {
+			var chirp streamedChirp
+			if json.Unmarshal(msg.Data, &chirp) != nil || !filter.allows(chirp.User_id) {
+				continue
+			}
+			if author != "" && chirp.User_id.String() != author {
+				continue
+			}
+		}
+		c.queue(wsServerMessage{Type: "event", Topic: topic, ID: msg.ID, Event: msg.Event, Data: msg.Data})
+	}
+	c.mu.Lock()
+	current := c.subs[topic] == sub
+	c.mu.Unlock()
+	if current {
+		// The hub dropped us for falling behind.
+		c.close(websocket.ClosePolicyViolation, "client too slow")
+	}
+}
+
+// queue hands msg to the writer without blocking. A client whose buffer is
+// full is disconnected.
+func (c *wsConn) queue(msg wsServerMessage) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		c.close(websocket.ClosePolicyViolation, "client too slow")
+	}
+}
+
+func (c *wsConn) readLoop() {
+	defer c.close(websocket.CloseNormalClosure, "")
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var msg wsClientMessage
+		err := c.conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("websocket for %s closed: %s", c.userID, err)
+			}
+			return
+		}
+		switch msg.Type {
+		case "subscribe":
+			c.subscribe(msg.Topic)
+		case "unsubscribe":
+			c.unsubscribe(msg.Topic)
+		case "ping":
+			c.queue(wsServerMessage{Type: "pong"})
+		default:
+			c.queue(wsServerMessage{Type: "error", Error: "unknown message type"})
+		}
+	}
+}
+
+// writeLoop is the only goroutine writing to the connection.
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if c.conn.WriteJSON(msg) != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// watchAccount closes the connection once the account is suspended, marked
+// for deletion or gone, which the handshake alone cannot catch.
+func (c *wsConn) watchAccount() {
+	ticker := time.NewTicker(wsStatusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			status, err := c.cfg.Queries.GetAccountStatus(context.Background(), c.userID)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				c.close(websocket.ClosePolicyViolation, "account deleted")
+				return
+			case err != nil:
+				log.Printf("error checking account status of %s: %s", c.userID, err)
+				c.close(websocket.CloseTryAgainLater, "error checking account status")
+				return
+			case status.SuspendedAt.Valid:
+				c.close(websocket.ClosePolicyViolation, "account suspended")
+				return
+			case status.DeletionRequestedAt.Valid:
+				c.close(websocket.ClosePolicyViolation, "account pending deletion")
+				return
+			}
+		}
+	}
+}
+
+func (c *wsConn) close(code int, reason string) {
+	c.once.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		c.closed = true
+		for topic, sub := range c.subs {
+			delete(c.subs, topic)
+			c.cfg.Hub.Unsubscribe(sub)
+		}
+		c.mu.Unlock()
+		message := websocket.FormatCloseMessage(code, reason)
+		c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteWait))
+		c.conn.Close()
+	})
+}